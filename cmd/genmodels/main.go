@@ -0,0 +1,370 @@
+// Genmodels writes Go structs for schemas of the OpenAPI document, with
+// binding tags and the registrations of the validators those tags use, so the
+// document stays the only place the rules are written down.
+//
+// Usage: genmodels -spec api.yml -out spec_gen.go Receipt Item
+//
+// Two extensions of the document steer the output. x-go-type gives the Go
+// type of a property, such as Money. x-go-validator names the validation tag
+// that checks a property's pattern or format, properties and parameters that
+// share a name must share the rule.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/jiyo4476/receipt-processor-challenge/spec"
+	"github.com/pb33f/libopenapi/datamodel/high/base"
+)
+
+// Formats checked by functions of the models package rather than a pattern
+var formatValidators = map[string]string{
+	"date": "CorrectDate",
+	"time": "CorrectTime",
+}
+
+type model struct {
+	Name    string
+	Comment string
+	Fields  []field
+}
+
+type field struct {
+	Name    string
+	Type    string
+	JSON    string
+	Binding string
+}
+
+// A validation tag and the rule it checks, either a pattern or a function
+type validator_rule struct {
+	Tag      string
+	Pattern  string
+	Function string
+	// Where the rule was first found, for reporting conflicts
+	source string
+}
+
+// The exported name of the validator.Func for a pattern rule
+func (r validator_rule) Name() string {
+	return strings.ToUpper(r.Tag[:1]) + r.Tag[1:]
+}
+
+func (r validator_rule) PatternVar() string {
+	return r.Tag + "Pattern"
+}
+
+type generator struct {
+	document   *spec.Spec
+	validators map[string]validator_rule
+}
+
+func main() {
+	specFile := flag.String("spec", "api.yml", "OpenAPI document to read")
+	out := flag.String("out", "spec_gen.go", "file to write")
+	pkg := flag.String("package", "models", "package of the generated file")
+	flag.Parse()
+
+	if err := run(*specFile, *out, *pkg, flag.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "genmodels: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(specFile string, out string, pkg string, schemas []string) error {
+	if len(schemas) == 0 {
+		return fmt.Errorf("no schemas given")
+	}
+	document, err := spec.Load(specFile)
+	if err != nil {
+		return err
+	}
+	source, err := generate(document, pkg, schemas)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, source, 0o644)
+}
+
+// Returns the formatted source of the structs for the named component schemas
+// and of every validator the document names
+func generate(document *spec.Spec, pkg string, schemas []string) ([]byte, error) {
+	g := &generator{document: document, validators: map[string]validator_rule{}}
+	components := document.Document.Model.Components
+	if components == nil || components.Schemas == nil {
+		return nil, fmt.Errorf("the document has no component schemas")
+	}
+
+	models := []model{}
+	for _, name := range schemas {
+		proxy := components.Schemas.GetOrZero(name)
+		if proxy == nil {
+			return nil, fmt.Errorf("no schema named %s", name)
+		}
+		compiled, err := g.model(name, proxy.Schema())
+		if err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+		models = append(models, compiled)
+	}
+	if err := g.parameterValidators(); err != nil {
+		return nil, err
+	}
+
+	rules := make([]validator_rule, 0, len(g.validators))
+	for _, rule := range g.validators {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Tag < rules[j].Tag })
+
+	var buf bytes.Buffer
+	err := outputTemplate.Execute(&buf, struct {
+		Package    string
+		Models     []model
+		Validators []validator_rule
+	}{pkg, models, rules})
+	if err != nil {
+		return nil, err
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("error formatting generated code: %w", err)
+	}
+	return source, nil
+}
+
+func (g *generator) model(name string, schema *base.Schema) (model, error) {
+	if schema == nil {
+		return model{}, fmt.Errorf("schema could not be built")
+	}
+	compiled := model{Name: name, Comment: schema.Description}
+	if schema.Properties == nil {
+		return compiled, nil
+	}
+	required := map[string]bool{}
+	for _, property := range schema.Required {
+		required[property] = true
+	}
+	for pair := schema.Properties.First(); pair != nil; pair = pair.Next() {
+		property := pair.Key()
+		f, err := g.field(name+"."+property, property, pair.Value(), required[property])
+		if err != nil {
+			return model{}, fmt.Errorf("property %s: %w", property, err)
+		}
+		compiled.Fields = append(compiled.Fields, f)
+	}
+	return compiled, nil
+}
+
+func (g *generator) field(source string, property string, proxy *base.SchemaProxy, required bool) (field, error) {
+	schema := proxy.Schema()
+	if schema == nil {
+		return field{}, fmt.Errorf("schema could not be built")
+	}
+	goType, err := typeOf(proxy)
+	if err != nil {
+		return field{}, err
+	}
+
+	binding := []string{}
+	if required {
+		binding = append(binding, "required")
+	}
+	binding = append(binding, bounds(schema)...)
+	tag, err := g.validator(source, schema)
+	if err != nil {
+		return field{}, err
+	}
+	if tag != "" {
+		binding = append(binding, tag)
+	}
+	// Items of other schemas are validated with their own tags
+	if schema.Items != nil && schema.Items.IsA() && schema.Items.A.GetReference() != "" {
+		binding = append(binding, "dive")
+	}
+
+	return field{
+		Name:    strings.ToUpper(property[:1]) + property[1:],
+		Type:    goType,
+		JSON:    property,
+		Binding: strings.Join(binding, ","),
+	}, nil
+}
+
+// The Go type of a property: its x-go-type, the name of the schema it refers
+// to, or the type matching its JSON type
+func typeOf(proxy *base.SchemaProxy) (string, error) {
+	if ref := proxy.GetReference(); ref != "" {
+		return ref[strings.LastIndex(ref, "/")+1:], nil
+	}
+	schema := proxy.Schema()
+	if goType := extension(schema, "x-go-type"); goType != "" {
+		return goType, nil
+	}
+	if len(schema.Type) != 1 {
+		return "", fmt.Errorf("a single type or x-go-type is required")
+	}
+	switch schema.Type[0] {
+	case "string":
+		return "string", nil
+	case "boolean":
+		return "bool", nil
+	case "number":
+		return "float64", nil
+	case "integer":
+		if schema.Format == "int32" {
+			return "int32", nil
+		}
+		return "int64", nil
+	case "array":
+		if schema.Items == nil || !schema.Items.IsA() {
+			return "", fmt.Errorf("arrays need an items schema")
+		}
+		item, err := typeOf(schema.Items.A)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + item, nil
+	}
+	return "", fmt.Errorf("type %s has no Go type, set x-go-type", schema.Type[0])
+}
+
+// Binding tags for the length and range limits of a schema
+func bounds(schema *base.Schema) []string {
+	tags := []string{}
+	for _, limit := range []struct {
+		tag   string
+		value *int64
+	}{{"min", schema.MinLength}, {"max", schema.MaxLength}, {"min", schema.MinItems}, {"max", schema.MaxItems}} {
+		if limit.value != nil {
+			tags = append(tags, fmt.Sprintf("%s=%d", limit.tag, *limit.value))
+		}
+	}
+	if schema.Minimum != nil {
+		tags = append(tags, fmt.Sprintf("gte=%v", *schema.Minimum))
+	}
+	if schema.Maximum != nil {
+		tags = append(tags, fmt.Sprintf("lte=%v", *schema.Maximum))
+	}
+	return tags
+}
+
+// Records the rule of the schema's x-go-validator and returns its tag, which
+// is empty when the schema names none
+func (g *generator) validator(source string, schema *base.Schema) (string, error) {
+	tag := extension(schema, "x-go-validator")
+	if tag == "" {
+		return "", nil
+	}
+	rule := validator_rule{Tag: tag, source: source}
+	switch {
+	case schema.Pattern != "":
+		if _, err := regexp.Compile(schema.Pattern); err != nil {
+			return "", fmt.Errorf("invalid pattern %q: %w", schema.Pattern, err)
+		}
+		rule.Pattern = schema.Pattern
+	case formatValidators[schema.Format] != "":
+		rule.Function = formatValidators[schema.Format]
+	default:
+		return "", fmt.Errorf("validator %s needs a pattern or a format with a checker", tag)
+	}
+
+	if existing, ok := g.validators[tag]; ok {
+		if existing.Pattern != rule.Pattern || existing.Function != rule.Function {
+			return "", fmt.Errorf("validator %s checks %s for %s but %s for %s",
+				tag, rule.describe(), source, existing.describe(), existing.source)
+		}
+		return tag, nil
+	}
+	g.validators[tag] = rule
+	return tag, nil
+}
+
+func (r validator_rule) describe() string {
+	if r.Pattern != "" {
+		return "pattern " + r.Pattern
+	}
+	return r.Function
+}
+
+// Records the validators named by operation parameters, which handlers bind
+// with the same tags
+func (g *generator) parameterValidators() error {
+	paths := g.document.Document.Model.Paths
+	if paths == nil {
+		return nil
+	}
+	for path := paths.PathItems.First(); path != nil; path = path.Next() {
+		for op := path.Value().GetOperations().First(); op != nil; op = op.Next() {
+			for _, param := range op.Value().Parameters {
+				if param.Schema == nil || param.Schema.Schema() == nil {
+					continue
+				}
+				source := fmt.Sprintf("%s %s parameter %s", strings.ToUpper(op.Key()), path.Key(), param.Name)
+				if _, err := g.validator(source, param.Schema.Schema()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func extension(schema *base.Schema, name string) string {
+	if schema.Extensions == nil {
+		return ""
+	}
+	node := schema.Extensions.GetOrZero(name)
+	if node == nil {
+		return ""
+	}
+	return node.Value
+}
+
+var outputTemplate = template.Must(template.New("models").Funcs(template.FuncMap{
+	"comment": func(text string) string {
+		return "// " + strings.Join(strings.Split(strings.TrimSpace(text), "\n"), "\n// ")
+	},
+	"quote": func(text string) string {
+		if strings.Contains(text, "`") {
+			return fmt.Sprintf("%q", text)
+		}
+		return "`" + text + "`"
+	},
+}).Parse(`// Code generated by genmodels from the OpenAPI document. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"regexp"
+
+	"github.com/go-playground/validator/v10"
+)
+{{range .Models}}
+{{if .Comment}}{{comment .Comment}}
+{{end}}type {{.Name}} struct {
+{{- range .Fields}}
+	{{.Name}} {{.Type}} ` + "`" + `json:"{{.JSON}}"{{if .Binding}} binding:"{{.Binding}}"{{end}}` + "`" + `
+{{- end}}
+}
+{{end}}
+{{- range .Validators}}{{if .Pattern}}
+var {{.PatternVar}} = regexp.MustCompile({{quote .Pattern}})
+
+var {{.Name}} validator.Func = matchesPattern({{.PatternVar}})
+{{end}}{{end}}
+// Registers the validations named by the binding tags
+func registerSpecValidators(v *validator.Validate) {
+{{- range .Validators}}
+	v.RegisterValidation("{{.Tag}}", {{if .Pattern}}{{.Name}}{{else}}{{.Function}}{{end}})
+{{- end}}
+}
+`))
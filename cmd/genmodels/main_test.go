@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/jiyo4476/receipt-processor-challenge/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+const generatorTestSpec = `
+openapi: 3.0.3
+info:
+    title: Test
+    version: 1.0.0
+paths:
+    /things:
+        get:
+            parameters:
+                - name: code
+                  in: query
+                  schema:
+                      type: string
+                      pattern: "^[a-z]+$"
+                      x-go-validator: thingCode
+            responses:
+                200:
+                    description: OK
+components:
+    schemas:
+        Thing:
+            description: A thing with parts
+            type: object
+            required: [code, parts]
+            properties:
+                code:
+                    type: string
+                    pattern: "^[a-z]+$"
+                    x-go-validator: thingCode
+                count:
+                    type: integer
+                    minimum: 1
+                price:
+                    type: string
+                    x-go-type: Money
+                parts:
+                    type: array
+                    minItems: 1
+                    items:
+                        $ref: "#/components/schemas/Part"
+        Part:
+            type: object
+            properties:
+                made:
+                    type: string
+                    format: date
+                    x-go-validator: correctDate
+`
+
+func TestGenerate(t *testing.T) {
+	document, err := spec.Parse([]byte(generatorTestSpec))
+	assert.NoError(t, err)
+	source, err := generate(document, "models", []string{"Thing", "Part"})
+	assert.NoError(t, err)
+
+	generated := string(source)
+	assert.Contains(t, generated, "// A thing with parts\ntype Thing struct {")
+	assert.Contains(t, generated, "Code  string `json:\"code\" binding:\"required,thingCode\"`")
+	assert.Contains(t, generated, "Count int64  `json:\"count\" binding:\"gte=1\"`")
+	assert.Contains(t, generated, "Price Money  `json:\"price\"`")
+	assert.Contains(t, generated, "Parts []Part `json:\"parts\" binding:\"required,min=1,dive\"`")
+	assert.Contains(t, generated, "var thingCodePattern = regexp.MustCompile(`^[a-z]+$`)")
+	assert.Contains(t, generated, `v.RegisterValidation("correctDate", CorrectDate)`)
+	assert.Equal(t, 1, strings.Count(generated, `v.RegisterValidation("thingCode", ThingCode)`), "Shared validators should be registered once")
+}
+
+func TestGenerate_Conflicts(t *testing.T) {
+	drifted := strings.Replace(generatorTestSpec, `pattern: "^[a-z]+$"`, `pattern: "^[a-z0-9]+$"`, 1)
+	document, err := spec.Parse([]byte(drifted))
+	assert.NoError(t, err)
+	_, err = generate(document, "models", []string{"Thing"})
+	if assert.Error(t, err, "A validator name with two patterns should be rejected") {
+		assert.Contains(t, err.Error(), "validator thingCode checks")
+	}
+
+	document, err = spec.Parse([]byte(generatorTestSpec))
+	assert.NoError(t, err)
+	_, err = generate(document, "models", []string{"Missing"})
+	assert.Error(t, err, "Unknown schemas should be rejected")
+}
+
+// The committed models have to be regenerated whenever api.yml changes
+func TestGenerate_ModelsAreCurrent(t *testing.T) {
+	document, err := spec.Load("../../api.yml")
+	assert.NoError(t, err)
+	source, err := generate(document, "models", []string{"Receipt", "Item"})
+	assert.NoError(t, err)
+	committed, err := os.ReadFile("../../models/spec_gen.go")
+	assert.NoError(t, err)
+	assert.Equal(t, string(committed), string(source), "models/spec_gen.go is out of date, run go generate ./models")
+}
@@ -0,0 +1,289 @@
+// Package csvimport reads receipts exported as CSV with one row per line item.
+// Rows sharing a receipt key are grouped into one receipt, which is validated
+// with the same rules as receipts posted to the API.
+package csvimport
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+)
+
+// Mapping names the CSV column holding each receipt and item field. Column
+// names are matched ignoring case and surrounding spaces.
+type Mapping struct {
+	Key              string `form:"key" json:"key"`
+	Retailer         string `form:"retailer" json:"retailer"`
+	PurchaseDate     string `form:"purchaseDate" json:"purchaseDate"`
+	PurchaseTime     string `form:"purchaseTime" json:"purchaseTime"`
+	Total            string `form:"total" json:"total"`
+	ShortDescription string `form:"shortDescription" json:"shortDescription"`
+	Price            string `form:"price" json:"price"`
+}
+
+func DefaultMapping() Mapping {
+	return Mapping{
+		Key:              "receipt_id",
+		Retailer:         "retailer",
+		PurchaseDate:     "purchase_date",
+		PurchaseTime:     "purchase_time",
+		Total:            "total",
+		ShortDescription: "short_description",
+		Price:            "price",
+	}
+}
+
+// RowError locates a problem in the CSV. Rows are numbered by the line they
+// start on, the header is row 1.
+type RowError struct {
+	Row     int    `json:"row"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e RowError) Error() string {
+	if e.Column == "" {
+		return fmt.Sprintf("row %d: %s", e.Row, e.Message)
+	}
+	return fmt.Sprintf("row %d, column %s: %s", e.Row, e.Column, e.Message)
+}
+
+// Result is the outcome for one grouped receipt
+type Result struct {
+	Key  string `json:"key"`
+	Rows []int  `json:"rows"`
+	// Set when the receipt was stored
+	ID     string     `json:"id,omitempty"`
+	Errors []RowError `json:"errors,omitempty"`
+}
+
+// Report summarizes an import
+type Report struct {
+	Receipts int `json:"receipts"`
+	Imported int `json:"imported"`
+	Rejected int `json:"rejected"`
+	// Rows that could not be assigned to a receipt
+	Errors  []RowError `json:"errors,omitempty"`
+	Results []Result   `json:"results"`
+}
+
+// Stores a valid receipt and returns its id
+type IngestFunc func(ctx context.Context, receipt models.Receipt) (string, error)
+
+type columns struct {
+	key, retailer, purchaseDate, purchaseTime, total, shortDescription, price int
+}
+
+type group struct {
+	result  Result
+	receipt models.Receipt
+	// Row of each item, for locating validation errors
+	itemRows []int
+	// Receipt level values of the first row, later rows must agree with them
+	first []string
+}
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.SetTagName("binding")
+	models.RegisterValidators(v)
+	return v
+}
+
+// Reads every row, groups them into receipts and passes each valid receipt to
+// ingest. Problems with single rows or receipts are listed in the report, an
+// error is only returned when the CSV cannot be read at all.
+func Import(ctx context.Context, r io.Reader, mapping Mapping, ingest IngestFunc) (Report, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return Report{}, RowError{Row: 1, Message: "file is empty"}
+	}
+	if err != nil {
+		return Report{}, readError(err)
+	}
+	cols, err := mapping.resolve(header)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Results: []Result{}}
+	groups := map[string]*group{}
+	order := []*group{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return Report{}, readError(err)
+		}
+		row, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			report.Errors = append(report.Errors, RowError{Row: row,
+				Message: fmt.Sprintf("row has %d columns, the header has %d", len(record), len(header))})
+			continue
+		}
+		key := strings.TrimSpace(record[cols.key])
+		if key == "" {
+			report.Errors = append(report.Errors, RowError{Row: row, Column: mapping.Key, Message: "receipt key is empty"})
+			continue
+		}
+		g, ok := groups[key]
+		if !ok {
+			g = &group{result: Result{Key: key}}
+			groups[key] = g
+			order = append(order, g)
+		}
+		g.add(row, record, cols, mapping)
+	}
+
+	for _, g := range order {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		report.Receipts++
+		if len(g.result.Errors) == 0 {
+			g.validate(mapping)
+		}
+		if len(g.result.Errors) == 0 {
+			id, err := ingest(ctx, g.receipt)
+			if err != nil {
+				g.result.Errors = append(g.result.Errors, RowError{Row: g.result.Rows[0], Message: err.Error()})
+			}
+			g.result.ID = id
+		}
+		if g.result.ID != "" {
+			report.Imported++
+		} else {
+			report.Rejected++
+		}
+		report.Results = append(report.Results, g.result)
+	}
+	return report, nil
+}
+
+func readError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return RowError{Row: parseErr.Line, Message: parseErr.Err.Error()}
+	}
+	return err
+}
+
+// Finds the index of every mapped column in the header
+func (m Mapping) resolve(header []string) (columns, error) {
+	index := map[string]int{}
+	for i, name := range header {
+		index[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	var cols columns
+	missing := []string{}
+	for _, field := range []struct {
+		name string
+		dst  *int
+	}{
+		{m.Key, &cols.key},
+		{m.Retailer, &cols.retailer},
+		{m.PurchaseDate, &cols.purchaseDate},
+		{m.PurchaseTime, &cols.purchaseTime},
+		{m.Total, &cols.total},
+		{m.ShortDescription, &cols.shortDescription},
+		{m.Price, &cols.price},
+	} {
+		i, ok := index[strings.ToLower(strings.TrimSpace(field.name))]
+		if !ok {
+			missing = append(missing, fmt.Sprintf("%q", field.name))
+			continue
+		}
+		*field.dst = i
+	}
+	if len(missing) > 0 {
+		return cols, RowError{Row: 1, Message: fmt.Sprintf("header is missing columns %s", strings.Join(missing, ", "))}
+	}
+	return cols, nil
+}
+
+// Adds a row to the receipt. The receipt fields are read from its first row,
+// every row adds an item.
+func (g *group) add(row int, record []string, cols columns, m Mapping) {
+	g.result.Rows = append(g.result.Rows, row)
+	fail := func(column string, err error) {
+		g.result.Errors = append(g.result.Errors, RowError{Row: row, Column: column, Message: err.Error()})
+	}
+
+	receiptFields := []string{
+		record[cols.retailer], record[cols.purchaseDate], record[cols.purchaseTime], record[cols.total],
+	}
+	if g.first == nil {
+		g.first = receiptFields
+		g.receipt.Retailer = record[cols.retailer]
+		var err error
+		if g.receipt.PurchaseDate, err = models.ParseDate(record[cols.purchaseDate]); err != nil {
+			fail(m.PurchaseDate, err)
+		}
+		if g.receipt.PurchaseTime, err = models.ParseTimeOfDay(record[cols.purchaseTime]); err != nil {
+			fail(m.PurchaseTime, err)
+		}
+		if g.receipt.Total, err = models.ParseMoney(record[cols.total]); err != nil {
+			fail(m.Total, err)
+		}
+	} else {
+		names := []string{m.Retailer, m.PurchaseDate, m.PurchaseTime, m.Total}
+		for i, value := range receiptFields {
+			if value != g.first[i] {
+				fail(names[i], fmt.Errorf("%q differs from %q on row %d of the same receipt", value, g.first[i], g.result.Rows[0]))
+			}
+		}
+	}
+
+	price, err := models.ParseMoney(record[cols.price])
+	if err != nil {
+		fail(m.Price, err)
+	}
+	g.receipt.Items = append(g.receipt.Items, models.Item{ShortDescription: record[cols.shortDescription], Price: price})
+	g.itemRows = append(g.itemRows, row)
+}
+
+var itemIndex = regexp.MustCompile(`\.Items\[(\d+)\]\.`)
+
+// Runs the API's validations and points each failure at its row and column
+func (g *group) validate(m Mapping) {
+	err := validate.Struct(g.receipt)
+	var invalid validator.ValidationErrors
+	if !errors.As(err, &invalid) {
+		if err != nil {
+			g.result.Errors = append(g.result.Errors, RowError{Row: g.result.Rows[0], Message: err.Error()})
+		}
+		return
+	}
+	for _, fe := range invalid {
+		row := g.result.Rows[0]
+		if match := itemIndex.FindStringSubmatch(fe.Namespace()); match != nil {
+			i, _ := strconv.Atoi(match[1])
+			row = g.itemRows[i]
+		}
+		column := map[string]string{
+			"Retailer":         m.Retailer,
+			"PurchaseDate":     m.PurchaseDate,
+			"PurchaseTime":     m.PurchaseTime,
+			"Total":            m.Total,
+			"ShortDescription": m.ShortDescription,
+			"Price":            m.Price,
+		}[fe.StructField()]
+		g.result.Errors = append(g.result.Errors, RowError{Row: row, Column: column,
+			Message: fmt.Sprintf("failed the %s validation", fe.Tag())})
+	}
+}
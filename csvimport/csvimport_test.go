@@ -0,0 +1,123 @@
+package csvimport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/stretchr/testify/assert"
+)
+
+const testCSV = `receipt_id,retailer,purchase_date,purchase_time,total,short_description,price
+A,Target,2022-01-01,13:01,18.74,Mountain Dew 12PK,6.49
+B,Walgreens,2022-01-02,08:13,2.65,Pepsi - 12-oz,1.25
+A,Target,2022-01-01,13:01,18.74,Emils Cheese Pizza,12.25
+B,Walgreens,2022-01-02,08:13,2.65,Dasani,1.40
+`
+
+type testStore struct {
+	receipts map[string]models.Receipt
+}
+
+func (s *testStore) ingest(ctx context.Context, receipt models.Receipt) (string, error) {
+	id := fmt.Sprintf("id-%d", len(s.receipts)+1)
+	s.receipts[id] = receipt
+	return id, nil
+}
+
+func runImport(t *testing.T, data string, mapping Mapping) (Report, *testStore) {
+	s := &testStore{receipts: map[string]models.Receipt{}}
+	report, err := Import(context.Background(), strings.NewReader(data), mapping, s.ingest)
+	assert.NoError(t, err, "Error importing CSV")
+	return report, s
+}
+
+func TestImport_GroupsRows(t *testing.T) {
+	report, s := runImport(t, testCSV, DefaultMapping())
+	assert.Equal(t, 2, report.Receipts)
+	assert.Equal(t, 2, report.Imported)
+	assert.Equal(t, 0, report.Rejected)
+	assert.Equal(t, "A", report.Results[0].Key)
+	assert.Equal(t, []int{2, 4}, report.Results[0].Rows)
+
+	receipt := s.receipts[report.Results[0].ID]
+	assert.Equal(t, "Target", receipt.Retailer)
+	assert.Equal(t, models.MustParseMoney("18.74"), receipt.Total)
+	assert.Len(t, receipt.Items, 2)
+	assert.Equal(t, "Emils Cheese Pizza", receipt.Items[1].ShortDescription)
+	assert.Equal(t, models.MustParseMoney("12.25"), receipt.Items[1].Price)
+}
+
+func TestImport_ColumnMapping(t *testing.T) {
+	data := `Store, Receipt No ,Date,Time,Amount,Item,Item Price
+Target,1,2022-01-01,13:01,6.49,Mountain Dew 12PK,6.49
+`
+	mapping := Mapping{
+		Key:              "receipt no",
+		Retailer:         "Store",
+		PurchaseDate:     "Date",
+		PurchaseTime:     "Time",
+		Total:            "Amount",
+		ShortDescription: "Item",
+		Price:            "Item Price",
+	}
+	report, s := runImport(t, data, mapping)
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, "Target", s.receipts[report.Results[0].ID].Retailer)
+}
+
+func TestImport_RowErrors(t *testing.T) {
+	data := `receipt_id,retailer,purchase_date,purchase_time,total,short_description,price
+A,Target,2022-02-30,13:01,6.49,Mountain Dew 12PK,6.49
+B,Walgreens,2022-01-02,08:13,2.65,Pepsi - 12-oz,1.25
+B,Walgreens,2022-01-02,08:13,2.65,Dasani!,1.40
+C,Target,2022-01-01,13:01,6.49,Doritos,6.49
+C,Walmart,2022-01-01,13:01,6.49,Doritos,abc
+,Target,2022-01-01,13:01,6.49,Doritos,6.49
+D,Target
+`
+	report, s := runImport(t, data, DefaultMapping())
+	assert.Equal(t, 3, report.Receipts)
+	assert.Equal(t, 0, report.Imported)
+	assert.Equal(t, 3, report.Rejected)
+	assert.Empty(t, s.receipts)
+
+	assert.Equal(t, []RowError{{Row: 2, Column: "purchase_date", Message: `invalid date "2022-02-30", the day does not exist`}}, report.Results[0].Errors)
+	assert.Equal(t, []RowError{{Row: 4, Column: "short_description", Message: "failed the correctShortDescription validation"}}, report.Results[1].Errors)
+	assert.Len(t, report.Results[2].Errors, 2)
+	assert.Equal(t, RowError{Row: 6, Column: "retailer", Message: `"Walmart" differs from "Target" on row 5 of the same receipt`}, report.Results[2].Errors[0])
+	assert.Equal(t, 6, report.Results[2].Errors[1].Row)
+	assert.Equal(t, "price", report.Results[2].Errors[1].Column)
+
+	assert.Equal(t, []RowError{
+		{Row: 7, Column: "receipt_id", Message: "receipt key is empty"},
+		{Row: 8, Message: "row has 2 columns, the header has 7"},
+	}, report.Errors)
+}
+
+func TestImport_InvalidFile(t *testing.T) {
+	s := &testStore{receipts: map[string]models.Receipt{}}
+	for data, row := range map[string]int{
+		"":                                  1,
+		"receipt_id,retailer\nA,B\n":        1,
+		testCSV + "C,\"Target,2022-01-01\n": 6,
+	} {
+		_, err := Import(context.Background(), strings.NewReader(data), DefaultMapping(), s.ingest)
+		var rowErr RowError
+		if assert.ErrorAs(t, err, &rowErr, "Expected a row error for %q", data) {
+			assert.Equal(t, row, rowErr.Row)
+		}
+	}
+}
+
+func TestImport_IngestError(t *testing.T) {
+	failing := func(ctx context.Context, receipt models.Receipt) (string, error) {
+		return "", fmt.Errorf("total does not match the sum of the item prices")
+	}
+	report, err := Import(context.Background(), strings.NewReader(testCSV), DefaultMapping(), failing)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, report.Rejected)
+	assert.Equal(t, RowError{Row: 2, Message: "total does not match the sum of the item prices"}, report.Results[0].Errors[0])
+}
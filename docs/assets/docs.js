@@ -0,0 +1,357 @@
+// Renders /openapi.json as browsable documentation with a form to try every
+// operation against this server. Everything it needs is served by the server
+// itself, so the page works offline.
+(function () {
+    "use strict";
+
+    var methods = ["get", "post", "put", "patch", "delete"];
+    var spec;
+
+    // Creates an element with the given attributes and children, strings
+    // become text so nothing from the document is parsed as HTML
+    function el(tag, attributes, children) {
+        var node = document.createElement(tag);
+        Object.keys(attributes || {}).forEach(function (name) {
+            if (name === "text") {
+                node.textContent = attributes[name];
+            } else {
+                node.setAttribute(name, attributes[name]);
+            }
+        });
+        (children || []).forEach(function (child) {
+            if (child === null || child === undefined) {
+                return;
+            }
+            node.appendChild(typeof child === "string" ? document.createTextNode(child) : child);
+        });
+        return node;
+    }
+
+    // Follows a local reference such as #/components/schemas/Receipt
+    function resolve(value) {
+        var seen = 0;
+        while (value && value.$ref && seen < 32) {
+            value = value.$ref.replace(/^#\//, "").split("/").reduce(function (node, key) {
+                key = key.replace(/~1/g, "/").replace(/~0/g, "~");
+                return node ? node[key] : undefined;
+            }, spec);
+            seen++;
+        }
+        return value || {};
+    }
+
+    function refName(value) {
+        return value && value.$ref ? value.$ref.split("/").pop() : null;
+    }
+
+    function constraints(schema) {
+        var parts = [];
+        if (schema.format) parts.push("format " + schema.format);
+        if (schema.pattern) parts.push("pattern " + schema.pattern);
+        if (schema.enum) parts.push("one of " + schema.enum.join(", "));
+        if (schema.minimum !== undefined) parts.push((schema.exclusiveMinimum ? "> " : "≥ ") + schema.minimum);
+        if (schema.maximum !== undefined) parts.push((schema.exclusiveMaximum ? "< " : "≤ ") + schema.maximum);
+        if (schema.minLength !== undefined) parts.push("min length " + schema.minLength);
+        if (schema.maxLength !== undefined) parts.push("max length " + schema.maxLength);
+        if (schema.minItems !== undefined) parts.push("min items " + schema.minItems);
+        if (schema.maxItems !== undefined) parts.push("max items " + schema.maxItems);
+        if (schema.default !== undefined) parts.push("default " + JSON.stringify(schema.default));
+        if (schema.nullable) parts.push("nullable");
+        return parts.join(", ");
+    }
+
+    function typeName(value) {
+        var schema = resolve(value);
+        var name = refName(value);
+        var type = [].concat(schema.type || (schema.properties ? "object" : "any")).join(" | ");
+        if (type === "array" && schema.items) {
+            type = typeName(schema.items) + "[]";
+        }
+        return name ? name : type;
+    }
+
+    // A nested list of the schema's properties. Referenced schemas are only
+    // expanded a few levels deep, so recursive schemas end.
+    function renderSchema(value, depth) {
+        var schema = resolve(value);
+        depth = depth || 0;
+        var list = el("ul");
+        var items = schema.type === "array" && schema.items ? resolve(schema.items) : schema;
+        var properties = items.properties || {};
+        var required = items.required || [];
+        Object.keys(properties).forEach(function (name) {
+            var property = properties[name];
+            var resolved = resolve(property);
+            var entry = el("li", {}, [
+                el("code", { text: name }),
+                " ",
+                el("span", { class: "type", text: typeName(property) }),
+                required.indexOf(name) >= 0 ? el("span", { class: "required", text: " required" }) : null,
+                constraints(resolved) ? el("span", { class: "constraint", text: " (" + constraints(resolved) + ")" }) : null,
+                resolved.description ? el("div", { class: "muted", text: resolved.description }) : null,
+            ]);
+            var nested = resolved.type === "array" && resolved.items ? resolve(resolved.items) : resolved;
+            if (nested.properties && depth < 4) {
+                entry.appendChild(renderSchema(property, depth + 1));
+            }
+            list.appendChild(entry);
+        });
+        ["allOf", "anyOf", "oneOf"].forEach(function (group) {
+            if (schema[group]) {
+                list.appendChild(el("li", {}, [
+                    el("span", { class: "constraint", text: group + ": " + schema[group].map(typeName).join(", ") }),
+                ]));
+            }
+        });
+        if (!list.childNodes.length) {
+            var text = typeName(value);
+            if (constraints(schema)) {
+                text += " (" + constraints(schema) + ")";
+            }
+            list.appendChild(el("li", { class: "type", text: text }));
+        }
+        return el("div", { class: "schema" }, [list]);
+    }
+
+    // An example value from the schema's examples, or one built from its
+    // properties
+    function example(value, depth) {
+        var schema = resolve(value);
+        depth = depth || 0;
+        if (schema.example !== undefined) return schema.example;
+        if (schema.default !== undefined) return schema.default;
+        if (schema.enum) return schema.enum[0];
+        if (depth > 6) return null;
+        if (schema.allOf) {
+            return schema.allOf.reduce(function (merged, part) {
+                return Object.assign(merged, example(part, depth + 1));
+            }, {});
+        }
+        if (schema.oneOf || schema.anyOf) return example((schema.oneOf || schema.anyOf)[0], depth + 1);
+        var type = [].concat(schema.type || (schema.properties ? "object" : "string"))[0];
+        if (type === "object") {
+            var result = {};
+            Object.keys(schema.properties || {}).forEach(function (name) {
+                result[name] = example(schema.properties[name], depth + 1);
+            });
+            return result;
+        }
+        if (type === "array") return schema.items ? [example(schema.items, depth + 1)] : [];
+        if (type === "integer" || type === "number") return schema.minimum || 0;
+        if (type === "boolean") return false;
+        return "";
+    }
+
+    function renderParameters(parameters, inputs) {
+        var rows = parameters.map(function (parameter) {
+            var schema = resolve(parameter.schema);
+            var input = el("input", { type: "text", placeholder: typeName(parameter.schema) });
+            if (schema.default !== undefined) {
+                input.value = schema.default;
+            }
+            inputs.push({ parameter: parameter, input: input });
+            return el("tr", {}, [
+                el("td", {}, [
+                    el("code", { text: parameter.name }),
+                    parameter.required ? el("div", { class: "required", text: "required" }) : null,
+                ]),
+                el("td", { text: parameter.in }),
+                el("td", {}, [
+                    parameter.description || "",
+                    constraints(schema) ? el("div", { class: "constraint muted", text: constraints(schema) }) : null,
+                ]),
+                el("td", {}, [input]),
+            ]);
+        });
+        return el("table", {}, [
+            el("thead", {}, [el("tr", {}, ["Name", "In", "Description", "Value"].map(function (heading) {
+                return el("th", { text: heading });
+            }))]),
+            el("tbody", {}, rows),
+        ]);
+    }
+
+    function renderResponses(responses) {
+        var list = el("div");
+        Object.keys(responses || {}).forEach(function (code) {
+            var response = resolve(responses[code]);
+            var entry = el("div", {}, [
+                el("h4", {}, [el("code", { text: code }), " " + (response.description || "")]),
+            ]);
+            Object.keys(response.content || {}).forEach(function (mediaType) {
+                var media = response.content[mediaType];
+                entry.appendChild(el("div", { class: "muted", text: mediaType }));
+                if (media.schema) {
+                    entry.appendChild(renderSchema(media.schema));
+                }
+            });
+            list.appendChild(entry);
+        });
+        return list;
+    }
+
+    // A form that sends the operation to this server and shows the response
+    function renderTry(path, method, operation, parameters) {
+        var inputs = [];
+        var form = el("div", { class: "try" }, [el("h4", { text: "Try it" })]);
+        if (parameters.length) {
+            form.appendChild(renderParameters(parameters, inputs));
+        }
+
+        var body = operation.requestBody ? resolve(operation.requestBody) : null;
+        var mediaSelect;
+        var textarea;
+        if (body && body.content) {
+            var mediaTypes = Object.keys(body.content);
+            mediaSelect = el("select", {}, mediaTypes.map(function (mediaType) {
+                return el("option", { value: mediaType, text: mediaType });
+            }));
+            textarea = el("textarea", { spellcheck: "false" });
+            var fill = function () {
+                var media = body.content[mediaSelect.value];
+                var value = media.example !== undefined ? media.example : example(media.schema);
+                textarea.value = typeof value === "string" ? value : JSON.stringify(value, null, 2);
+            };
+            mediaSelect.addEventListener("change", fill);
+            fill();
+            form.appendChild(el("div", {}, [el("label", { text: "Body " }), mediaSelect]));
+            form.appendChild(textarea);
+        }
+
+        var output = el("div");
+        var button = el("button", { type: "button", text: "Send" });
+        button.addEventListener("click", function () {
+            var url = path;
+            var query = new URLSearchParams();
+            var headers = {};
+            inputs.forEach(function (entry) {
+                var value = entry.input.value;
+                if (value === "") return;
+                if (entry.parameter.in === "path") {
+                    url = url.replace("{" + entry.parameter.name + "}", encodeURIComponent(value));
+                } else if (entry.parameter.in === "query") {
+                    query.append(entry.parameter.name, value);
+                } else if (entry.parameter.in === "header") {
+                    headers[entry.parameter.name] = value;
+                }
+            });
+            if (query.toString()) {
+                url += "?" + query.toString();
+            }
+            var authorization = document.getElementById("authorization").value.trim();
+            if (authorization) {
+                headers.Authorization = authorization;
+            }
+            var request = { method: method.toUpperCase(), headers: headers };
+            if (textarea) {
+                headers["Content-Type"] = mediaSelect.value;
+                request.body = textarea.value;
+            }
+
+            output.textContent = "Sending…";
+            fetch(url, request).then(function (response) {
+                return response.text().then(function (text) {
+                    var shown = text;
+                    try {
+                        shown = JSON.stringify(JSON.parse(text), null, 2);
+                    } catch (e) {
+                        // Not a single JSON value, such as an NDJSON stream
+                    }
+                    output.textContent = "";
+                    output.appendChild(el("h4", {
+                        class: "status " + (response.ok ? "success" : "failure"),
+                        text: response.status + " " + response.statusText,
+                    }));
+                    output.appendChild(el("pre", { text: shown || "(no body)" }));
+                });
+            }).catch(function (error) {
+                output.textContent = "";
+                output.appendChild(el("pre", { class: "status failure", text: String(error) }));
+            });
+        });
+        form.appendChild(button);
+        form.appendChild(output);
+        return form;
+    }
+
+    function renderOperation(path, method, operation, shared) {
+        // Parameters of the operation override those of the path
+        var parameters = (operation.parameters || []).map(resolve);
+        (shared || []).map(resolve).forEach(function (parameter) {
+            var overridden = parameters.some(function (own) {
+                return own.name === parameter.name && own.in === parameter.in;
+            });
+            if (!overridden) parameters.push(parameter);
+        });
+
+        var body = el("div", { class: "body" }, [
+            operation.description ? el("p", { text: operation.description }) : null,
+        ]);
+        if (operation.requestBody) {
+            var requestBody = resolve(operation.requestBody);
+            body.appendChild(el("h4", { text: "Request body" + (requestBody.required ? " (required)" : "") }));
+            Object.keys(requestBody.content || {}).forEach(function (mediaType) {
+                body.appendChild(el("div", { class: "muted", text: mediaType }));
+                if (requestBody.content[mediaType].schema) {
+                    body.appendChild(renderSchema(requestBody.content[mediaType].schema));
+                }
+            });
+        }
+        body.appendChild(el("h4", { text: "Responses" }));
+        body.appendChild(renderResponses(operation.responses));
+        body.appendChild(renderTry(path, method, operation, parameters));
+
+        return el("details", { class: "operation" }, [
+            el("summary", {}, [
+                el("span", { class: "method " + method, text: method }),
+                el("span", { class: "path", text: path }),
+                el("span", { class: "muted", text: operation.summary || "" }),
+            ]),
+            body,
+        ]);
+    }
+
+    function render() {
+        document.title = spec.info.title + " " + spec.info.version;
+        document.getElementById("title").textContent = spec.info.title + " " + spec.info.version;
+        document.getElementById("description").textContent = spec.info.description || "";
+
+        var operations = document.getElementById("operations");
+        operations.textContent = "";
+        Object.keys(spec.paths || {}).forEach(function (path) {
+            var item = spec.paths[path];
+            methods.forEach(function (method) {
+                if (item[method]) {
+                    operations.appendChild(renderOperation(path, method, item[method], item.parameters));
+                }
+            });
+        });
+
+        var schemas = document.getElementById("schemas");
+        var components = (spec.components || {}).schemas || {};
+        Object.keys(components).forEach(function (name) {
+            var schema = components[name];
+            schemas.appendChild(el("details", { class: "operation", id: "schema-" + name }, [
+                el("summary", {}, [el("span", { class: "path", text: name })]),
+                el("div", { class: "body" }, [
+                    schema.description ? el("p", { text: schema.description }) : null,
+                    renderSchema(schema),
+                ]),
+            ]));
+        });
+    }
+
+    fetch("/openapi.json").then(function (response) {
+        if (!response.ok) {
+            throw new Error("GET /openapi.json returned " + response.status);
+        }
+        return response.json();
+    }).then(function (loaded) {
+        spec = loaded;
+        render();
+    }).catch(function (error) {
+        var operations = document.getElementById("operations");
+        operations.textContent = "";
+        operations.appendChild(el("p", { class: "status failure", text: "Could not load the API description: " + error.message }));
+    });
+})();
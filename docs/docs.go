@@ -0,0 +1,62 @@
+// Package docs serves the OpenAPI document and a documentation page for it.
+// The page and its assets are embedded in the binary, so it works offline.
+package docs
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiyo4476/receipt-processor-challenge/spec"
+)
+
+//go:embed assets
+var assets embed.FS
+
+// Docs holds the document rendered for the running server
+type Docs struct {
+	yaml []byte
+	json []byte
+	page []byte
+}
+
+// Renders the document with serverURL as its server, where the docs page
+// sends the requests it tries
+func New(document *spec.Spec, serverURL string) (*Docs, error) {
+	yamlDocument, jsonDocument, err := document.Render(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	page, err := assets.ReadFile("assets/index.html")
+	if err != nil {
+		return nil, fmt.Errorf("error reading docs page: %w", err)
+	}
+	return &Docs{yaml: yamlDocument, json: jsonDocument, page: page}, nil
+}
+
+// Returns the OpenAPI document as YAML
+func (d *Docs) YAML(c *gin.Context) {
+	c.Data(http.StatusOK, "application/yaml; charset=utf-8", d.yaml)
+}
+
+// Returns the OpenAPI document as JSON
+func (d *Docs) JSON(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json; charset=utf-8", d.json)
+}
+
+// Returns the documentation page, which loads the JSON document
+func (d *Docs) Page(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", d.page)
+}
+
+// The scripts and styles of the documentation page
+func Assets() http.FileSystem {
+	sub, err := fs.Sub(assets, "assets")
+	if err != nil {
+		// The directory is embedded, so it is always there
+		panic(err)
+	}
+	return http.FS(sub)
+}
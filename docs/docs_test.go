@@ -0,0 +1,67 @@
+package docs
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiyo4476/receipt-processor-challenge/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+func createDocsTestRouter(t *testing.T) *gin.Engine {
+	document, err := spec.Load("../api.yml")
+	assert.NoError(t, err, "Error loading spec")
+	documentation, err := New(document, "http://receipts.test:9090")
+	assert.NoError(t, err, "Error rendering docs")
+
+	router := gin.New()
+	router.GET("/openapi.yaml", documentation.YAML)
+	router.GET("/openapi.json", documentation.JSON)
+	router.GET("/docs", documentation.Page)
+	router.StaticFS("/docs/assets", Assets())
+	return router
+}
+
+func get(router http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestDocs_Documents(t *testing.T) {
+	router := createDocsTestRouter(t)
+	for path, contentType := range map[string]string{
+		"/openapi.yaml": "application/yaml; charset=utf-8",
+		"/openapi.json": "application/json; charset=utf-8",
+	} {
+		w := get(router, path)
+		assert.Equal(t, http.StatusOK, w.Code, path)
+		assert.Equal(t, contentType, w.Header().Get("Content-Type"), path)
+
+		document, err := spec.Parse(w.Body.Bytes())
+		if assert.NoError(t, err, "The served document should load") {
+			assert.Equal(t, "http://receipts.test:9090", document.Document.Model.Servers[0].URL, path)
+		}
+	}
+}
+
+func TestDocs_Page(t *testing.T) {
+	router := createDocsTestRouter(t)
+	w := get(router, "/docs")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+
+	// Every asset the page links to is embedded, nothing is loaded from elsewhere
+	page := w.Body.String()
+	for _, asset := range []string{"/docs/assets/docs.css", "/docs/assets/docs.js"} {
+		assert.Contains(t, page, `"`+asset+`"`)
+		w := get(router, asset)
+		assert.Equal(t, http.StatusOK, w.Code, asset)
+		assert.NotEmpty(t, w.Body.String(), asset)
+	}
+	assert.False(t, strings.Contains(page, "https://") || strings.Contains(page, "http://"), "The page should not load anything remotely")
+	assert.Equal(t, http.StatusNotFound, get(router, "/docs/assets/missing.js").Code)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
+	"go.uber.org/zap"
+)
+
+// Deletes the receipt. Its history can still be fetched.
+func (h *Handler) DeleteReceipt(c *gin.Context) {
+	lock := h.editLock(c.Param("id"))
+	lock.Lock()
+	defer lock.Unlock()
+	id, record, ok := h.findReceipt(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	record.Revisions = record.History()
+	record.DeletedAt = &now
+	record.AddRevision(store.RevisionDelete, now, submitter(c))
+	if err := h.Receipts.Put(c.Request.Context(), id, record); err != nil {
+		zap.L().Error(fmt.Sprintf("Error deleting receipt %s: %v", id, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete receipt", "message": "receipt could not be deleted"})
+		return
+	}
+	zap.L().Info(fmt.Sprintf("Deleted receipt %s", id))
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
+	"go.uber.org/zap"
+)
+
+type stored_receipt struct {
+	ID      string         `json:"id"`
+	Receipt models.Receipt `json:"receipt"`
+	// Unknown for receipts stored before ingest times were recorded
+	IngestedAt   *time.Time `json:"ingestedAt,omitempty"`
+	Points       int64      `json:"points"`
+	RuleVersion  int        `json:"ruleVersion"`
+	Inconsistent bool       `json:"inconsistent"`
+	// Set when the receipt was accepted or last changed as a duplicate of
+	// another
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+	// The client identity that submitted the receipt, such as key:pos-terminals
+	SubmittedBy string `json:"submittedBy,omitempty"`
+}
+
+// Returns the receipt as it was submitted along with the points it was awarded
+func (h *Handler) GetReceipt(c *gin.Context) {
+	id, record, ok := h.findReceipt(c)
+	if !ok {
+		return
+	}
+	zap.L().Info(fmt.Sprintf("Getting receipt %s", id))
+	c.JSON(http.StatusOK, h.storedReceipt(id, record))
+}
+
+func (h *Handler) storedReceipt(id string, record store.Record) stored_receipt {
+	response := stored_receipt{
+		ID:           id,
+		Receipt:      record.Receipt,
+		Inconsistent: record.Inconsistent,
+		DuplicateOf:  record.DuplicateOf,
+		SubmittedBy:  record.SubmittedBy,
+	}
+	if !record.CreatedAt.IsZero() {
+		response.IngestedAt = &record.CreatedAt
+	}
+	response.Points, response.RuleVersion = h.pointsFor(record, 0)
+	return response
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Returns every revision of the receipt, including deleted receipts
+func (h *Handler) GetReceiptHistory(c *gin.Context) {
+	id, record, ok := h.findRecord(c)
+	if !ok {
+		return
+	}
+	zap.L().Info(fmt.Sprintf("Getting history for %s", id))
+	c.JSON(http.StatusOK, gin.H{
+		"id":        id,
+		"deleted":   record.DeletedAt != nil,
+		"revisions": record.History(),
+	})
+}
@@ -1,10 +1,12 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
 	"github.com/jiyo4476/receipt-processor-challenge/store"
 	"go.uber.org/zap"
 )
@@ -13,27 +15,105 @@ type receipt_id struct {
 	ID string `uri:"id" binding:"required,uuid"`
 }
 
-func GetReceiptsPoints(c *gin.Context) {
+type rule_version struct {
+	RuleVersion *int `form:"ruleVersion" binding:"omitempty,min=1"`
+}
+
+// Looks up the receipt named by the id path parameter. When it cannot be found
+// or has been deleted the error response has already been written and ok is
+// false.
+func (h *Handler) findReceipt(c *gin.Context) (id string, record store.Record, ok bool) {
+	id, record, ok = h.findRecord(c)
+	if ok && record.DeletedAt != nil {
+		zap.L().Warn(fmt.Sprintf("Receipt %s has been deleted", id))
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "message": "No receipt found for that id"})
+		return "", store.Record{}, false
+	}
+	return id, record, ok
+}
+
+// Like findReceipt but also finds deleted receipts
+func (h *Handler) findRecord(c *gin.Context) (id string, record store.Record, ok bool) {
 	var receiptId receipt_id
 	if err := c.ShouldBindUri(&receiptId); err != nil {
 		zap.L().Warn(fmt.Sprintf("Validation Error:  %v", err.Error()))
-		c.JSON(http.StatusNotFound, gin.H{"code": "error", "message": "No receipt found for that id"})
-		return
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "message": "No receipt found for that id"})
+		return "", store.Record{}, false
 	}
 
-	id := c.Param("id")
-	zap.L().Info(fmt.Sprintf("Getting points for %s", id))
+	id = c.Param("id")
+	record, err := h.Receipts.Get(c.Request.Context(), id)
+	if errors.Is(err, store.ErrNotFound) {
+		zap.L().Warn(fmt.Sprintf("No receipt found for id: %s", id))
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found", "message": "No receipt found for that id"})
+		return "", store.Record{}, false
+	}
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Error loading receipt %s: %v", id, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load receipt", "message": "receipt could not be loaded"})
+		return "", store.Record{}, false
+	}
+	return id, record, true
+}
 
-	receipt, ok := store.Receipts[id]
+// Returns the version requested with ?ruleVersion=, or zero when the receipt's
+// own version should be used. Unknown versions write a 400 response.
+func (h *Handler) requestedRuleVersion(c *gin.Context) (int, bool) {
+	var query rule_version
+	if err := c.ShouldBindQuery(&query); err != nil {
+		zap.L().Warn(fmt.Sprintf("Validation Error:  %v", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule version", "message": "ruleVersion must be a positive number"})
+		return 0, false
+	}
+	if query.RuleVersion == nil {
+		return 0, true
+	}
+	if _, ok := h.Rules.Version(*query.RuleVersion); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule version", "message": fmt.Sprintf("Unknown rule version %d", *query.RuleVersion)})
+		return 0, false
+	}
+	return *query.RuleVersion, true
+}
+
+// Rules to explain or rescore a stored receipt with. Receipts stored before
+// rule sets were versioned, or whose version is no longer loaded, use the
+// current rules.
+func (h *Handler) rulesFor(record store.Record, requested int) models.RuleSet {
+	version := requested
+	if version == 0 {
+		version = record.RuleVersion
+	}
+	if rules, ok := h.Rules.Version(version); ok {
+		return rules
+	}
+	return h.Rules.Current()
+}
+
+// Points awarded at ingest stay fixed unless another version is requested
+func (h *Handler) pointsFor(record store.Record, requested int) (points int64, version int) {
+	if requested == 0 && record.RuleVersion != 0 {
+		return record.Points, record.RuleVersion
+	}
+	rules := h.rulesFor(record, requested)
+	points, _ = rules.Points(record.Receipt)
+	return points, rules.Version
+}
+
+func (h *Handler) GetReceiptsPoints(c *gin.Context) {
+	id, record, ok := h.findReceipt(c)
 	if !ok {
-		zap.L().Warn(fmt.Sprintf("No receipt found for id: %s", id))
-		c.JSON(http.StatusNotFound, gin.H{"code": "error", "message": "No receipt found for that id"})
 		return
 	}
+	requested, ok := h.requestedRuleVersion(c)
+	if !ok {
+		return
+	}
+	zap.L().Info(fmt.Sprintf("Getting points for %s", id))
 
-	points, _ := receipt.Points()
-	zap.L().Info(fmt.Sprintf("%d points found for id %s", points, id))
+	points, version := h.pointsFor(record, requested)
+	zap.L().Info(fmt.Sprintf("%d points found for id %s under rule version %d", points, id, version))
 	c.JSON(http.StatusOK, gin.H{
-		"points": points,
+		"points":      points,
+		"ruleVersion": version,
 	})
 }
@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// Returns the points awarded by each rule along with the reason
+func (h *Handler) GetReceiptsPointsBreakdown(c *gin.Context) {
+	id, record, ok := h.findReceipt(c)
+	if !ok {
+		return
+	}
+	requested, ok := h.requestedRuleVersion(c)
+	if !ok {
+		return
+	}
+	zap.L().Info(fmt.Sprintf("Getting points breakdown for %s", id))
+
+	rules := h.rulesFor(record, requested)
+	breakdown, err := rules.Breakdown(record.Receipt)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Error scoring receipt %s: %v", id, err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to score receipt", "message": "receipt could not be scored"})
+		return
+	}
+	c.JSON(http.StatusOK, breakdown)
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiyo4476/receipt-processor-challenge/middleware"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
+)
+
+// Handler holds the dependencies shared by the receipt endpoints
+type Handler struct {
+	Receipts store.ReceiptStore
+	Rules    *models.RuleRegistry
+	// Whether receipts whose total does not match their items are accepted
+	Consistency models.ConsistencyPolicy
+	// Whether receipts already stored are accepted again, zero allows them
+	Duplicates models.DuplicatePolicy
+	// Serializes changes to each stored receipt so no revision is lost,
+	// picked by a hash of the receipt's id
+	editLocks [16]sync.Mutex
+	// Serializes the duplicate check and save of receipts with the same
+	// fingerprint, picked by the first hex digit of the fingerprint
+	fingerprintLocks [16]sync.Mutex
+}
+
+func New(receipts store.ReceiptStore, rules *models.RuleRegistry, consistency models.ConsistencyPolicy, duplicates models.DuplicatePolicy) *Handler {
+	return &Handler{Receipts: receipts, Rules: rules, Consistency: consistency, Duplicates: duplicates}
+}
+
+// The qualified identity the request was authenticated as, such as
+// "key:pos-terminals", empty when authentication is off
+func submitter(c *gin.Context) string {
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
+		return ""
+	}
+	return principal.Identity()
+}
@@ -2,22 +2,49 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/jiyo4476/receipt-processor-challenge/middleware"
 	"github.com/jiyo4476/receipt-processor-challenge/models"
 	"github.com/jiyo4476/receipt-processor-challenge/router"
+	"github.com/jiyo4476/receipt-processor-challenge/spec"
+	"github.com/jiyo4476/receipt-processor-challenge/spec/spectest"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
-func makeRequest(method string, url string, body interface{}) (*httptest.ResponseRecorder, error) {
-	test_router := router.SetUpRouter()
+// Shared by every request so receipts processed in a test can be read back
+var testStore = store.NewMemoryStore()
+
+// Responses of every test are checked against the spec
+var apiSpec, apiSpecErr = spec.Load("../api.yml")
+
+// A router whose responses fail the test when they do not match the spec
+func newTestRouter(t *testing.T, cfg router.Config) http.Handler {
+	if apiSpecErr != nil {
+		t.Fatalf("Error loading spec: %v", apiSpecErr)
+	}
+	return spectest.Handler(t, apiSpec, router.SetUpRouter(cfg))
+}
+
+func makeRequest(t *testing.T, method string, url string, body interface{}) (*httptest.ResponseRecorder, error) {
+	return makeRequestWithConfig(t, router.Config{Receipts: testStore}, method, url, body)
+}
+
+func makeRequestWithConfig(t *testing.T, cfg router.Config, method string, url string, body interface{}) (*httptest.ResponseRecorder, error) {
+	test_router := newTestRouter(t, cfg)
 	w := httptest.NewRecorder()
 	c, _ := gin.CreateTestContext(w)
 	c.Request = httptest.NewRequest(method, url, nil)
@@ -35,7 +62,7 @@ func makeRequest(method string, url string, body interface{}) (*httptest.Respons
 }
 
 func attemptProcessReceipt(t *testing.T, receipt models.Receipt) (string, error) {
-	w, err := makeRequest("POST", "/receipts/process", receipt)
+	w, err := makeRequest(t, "POST", "/receipts/process", receipt)
 	assert.NoError(t, err, "error making request")
 	if err != nil {
 		t.Fatalf("error making POST request")
@@ -59,7 +86,7 @@ func attemptProcessReceipt(t *testing.T, receipt models.Receipt) (string, error)
 
 func attemptGetPoints(t *testing.T, id string) (int64, error) {
 	endpoint := fmt.Sprintf("/receipts/%s/points", id)
-	w, err := makeRequest("GET", endpoint, nil)
+	w, err := makeRequest(t, "GET", endpoint, nil)
 	assert.NoError(t, err, "error making request")
 	if err != nil {
 		t.Fatalf("error making GET request")
@@ -81,7 +108,7 @@ func attemptGetPoints(t *testing.T, id string) (int64, error) {
 func TestGetReceiptsPoints_NotFound(t *testing.T) {
 	// Try to fetch points with an invalid ID
 	endpoint := "/receipts/adb6b560-0eef-42bc-9d16-df48f30e89b2/points"
-	res, err := makeRequest("GET", endpoint, nil)
+	res, err := makeRequest(t, "GET", endpoint, nil)
 	if err != nil {
 		t.Fatalf("Error making GET request: %v", err)
 	}
@@ -92,7 +119,7 @@ func TestGetReceiptsPoints_NotFound(t *testing.T) {
 // Test Invalid
 func TestGetReceiptsPoints_InvalidUUID_Hyphen(t *testing.T) {
 	endpoint := fmt.Sprintf("/receipts/%s/points", "0000000--0000-0000-0000-000000000000")
-	w, err := makeRequest("GET", endpoint, nil)
+	w, err := makeRequest(t, "GET", endpoint, nil)
 	assert.Equal(t, http.StatusNotFound, w.Code, "Expected 404 status code for id")
 	if err != nil {
 		t.Fatalf("Error making request: %v", err)
@@ -101,7 +128,7 @@ func TestGetReceiptsPoints_InvalidUUID_Hyphen(t *testing.T) {
 
 func TestGetReceiptsPoints_InvalidUUID_Whitespace(t *testing.T) {
 	endpoint := fmt.Sprintf("/receipts/%s/points", "0000000%20-0000-0000-0000-000000000000")
-	w, err := makeRequest("GET", endpoint, nil)
+	w, err := makeRequest(t, "GET", endpoint, nil)
 	assert.Equal(t, http.StatusNotFound, w.Code, "Expected 404 status code for id")
 	if err != nil {
 		t.Fatalf("Error making request: %v", err)
@@ -111,13 +138,13 @@ func TestGetReceiptsPoints_InvalidUUID_Whitespace(t *testing.T) {
 func TestProcessReceipt_ValidReceipt(t *testing.T) {
 	receipt := models.Receipt{
 		Retailer:     "Target",
-		PurchaseDate: "2022-12-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: models.MustParseDate("2022-12-01"),
+		PurchaseTime: models.MustParseTimeOfDay("13:01"),
 		Items: []models.Item{
-			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
-			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+			{ShortDescription: "Mountain Dew 12PK", Price: models.MustParseMoney("6.49")},
+			{ShortDescription: "Emils Cheese Pizza", Price: models.MustParseMoney("12.25")},
 		},
-		Total: "18.74",
+		Total: models.MustParseMoney("18.74"),
 	}
 
 	id, err := attemptProcessReceipt(t, receipt)
@@ -134,18 +161,18 @@ func TestProcessReceipt_ValidReceipt(t *testing.T) {
 }
 
 func TestProcessReceipt_InvalidReceipt_Date(t *testing.T) {
-	receipt := models.Receipt{
-		Retailer:     "Target",
-		PurchaseDate: "2022-01-01-01", // Invalid date format
-		PurchaseTime: "13:01",
-		Items: []models.Item{
-			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
-			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+	receipt := gin.H{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01-01", // Invalid date format
+		"purchaseTime": "13:01",
+		"items": []gin.H{
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+			{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
 		},
-		Total: "18.74",
+		"total": "18.74",
 	}
 
-	w, err := makeRequest("POST", "/receipts/process", receipt)
+	w, err := makeRequest(t, "POST", "/receipts/process", receipt)
 	if err != nil {
 		t.Fatalf("Error making request: %v", err)
 	}
@@ -154,18 +181,18 @@ func TestProcessReceipt_InvalidReceipt_Date(t *testing.T) {
 }
 
 func TestProcessReceipt_InvalidReceipt_Time(t *testing.T) {
-	receipt := models.Receipt{
-		Retailer:     "Target",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "abcd",
-		Items: []models.Item{
-			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
-			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
+	receipt := gin.H{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "abcd",
+		"items": []gin.H{
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+			{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
 		},
-		Total: "18.74",
+		"total": "18.74",
 	}
 
-	w, err := makeRequest("POST", "/receipts/process", receipt)
+	w, err := makeRequest(t, "POST", "/receipts/process", receipt)
 	if err != nil {
 		t.Fatalf("Error making request: %v", err)
 	}
@@ -174,15 +201,15 @@ func TestProcessReceipt_InvalidReceipt_Time(t *testing.T) {
 }
 
 func TestProcessReceipt_InvalidReceipt_Total(t *testing.T) {
-	receipt := models.Receipt{
-		Retailer:     "", // Missing retailer
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
-		Items:        []models.Item{},
-		Total:        "abc", // Invalid total
+	receipt := gin.H{
+		"retailer":     "", // Missing retailer
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items":        []gin.H{},
+		"total":        "abc", // Invalid total
 	}
 
-	w, err := makeRequest("POST", "/receipts/process", receipt)
+	w, err := makeRequest(t, "POST", "/receipts/process", receipt)
 	if err != nil {
 		t.Fatalf("Error making request: %v", err)
 	}
@@ -191,7 +218,7 @@ func TestProcessReceipt_InvalidReceipt_Total(t *testing.T) {
 }
 
 func TestProcessReceipt_Invalid_Body(t *testing.T) {
-	w, err := makeRequest("POST", "/receipts/process", nil)
+	w, err := makeRequest(t, "POST", "/receipts/process", nil)
 	if err != nil {
 		t.Fatalf("Error making request: %v", err)
 	}
@@ -201,20 +228,19 @@ func TestProcessReceipt_Invalid_Body(t *testing.T) {
 
 func TestProcessReceipt_InvalidReceipt_No_DateAndTime(t *testing.T) {
 	receipt := models.Receipt{
-		Retailer:     "Target",
-		PurchaseDate: "", // Missing PurchaseDate
-		PurchaseTime: "", // Missing PurchaseTime
+		Retailer: "Target",
+		// Missing PurchaseDate and PurchaseTime
 		Items: []models.Item{
-			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
-			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
-			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
-			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
-			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+			{ShortDescription: "Mountain Dew 12PK", Price: models.MustParseMoney("6.49")},
+			{ShortDescription: "Emils Cheese Pizza", Price: models.MustParseMoney("12.25")},
+			{ShortDescription: "Knorr Creamy Chicken", Price: models.MustParseMoney("1.26")},
+			{ShortDescription: "Doritos Nacho Cheese", Price: models.MustParseMoney("3.35")},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: models.MustParseMoney("12.00")},
 		},
-		Total: "01.64",
+		Total: models.MustParseMoney("01.64"),
 	}
 
-	w, err := makeRequest("POST", "/receipts/process", receipt)
+	w, err := makeRequest(t, "POST", "/receipts/process", receipt)
 	if err != nil {
 		t.Fatalf("Error making request: %v", err)
 	}
@@ -223,21 +249,21 @@ func TestProcessReceipt_InvalidReceipt_No_DateAndTime(t *testing.T) {
 }
 
 func TestProcessReceipt_InvalidTotal(t *testing.T) {
-	receipt := models.Receipt{
-		Retailer:     "Target",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
-		Items: []models.Item{
-			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
-			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
-			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
-			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
-			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+	receipt := gin.H{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": []gin.H{
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+			{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+			{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+			{"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+			{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"},
 		},
-		Total: "01.64.00", // Invalid Total
+		"total": "01.64.00", // Invalid Total
 	}
 
-	w, err := makeRequest("POST", "/receipts/process", receipt)
+	w, err := makeRequest(t, "POST", "/receipts/process", receipt)
 	if err != nil {
 		t.Fatalf("Error making request: %v", err)
 	}
@@ -246,21 +272,21 @@ func TestProcessReceipt_InvalidTotal(t *testing.T) {
 }
 
 func TestProcessReceipt_Invalid_Item_Price(t *testing.T) {
-	receipt := models.Receipt{
-		Retailer:     "Target",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
-		Items: []models.Item{
-			{ShortDescription: "Mountain Dew 12PK", Price: "6.49.00"},
-			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
-			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
-			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
-			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+	receipt := gin.H{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": []gin.H{
+			{"shortDescription": "Mountain Dew 12PK", "price": "6.49.00"},
+			{"shortDescription": "Emils Cheese Pizza", "price": "12.25"},
+			{"shortDescription": "Knorr Creamy Chicken", "price": "1.26"},
+			{"shortDescription": "Doritos Nacho Cheese", "price": "3.35"},
+			{"shortDescription": "   Klarbrunn 12-PK 12 FL OZ  ", "price": "12.00"},
 		},
-		Total: "01.64", // Invalid Total
+		"total": "01.64", // Invalid Total
 	}
 
-	w, err := makeRequest("POST", "/receipts/process", receipt)
+	w, err := makeRequest(t, "POST", "/receipts/process", receipt)
 	if err != nil {
 		t.Fatalf("Error making request: %v", err)
 	}
@@ -268,19 +294,54 @@ func TestProcessReceipt_Invalid_Item_Price(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code, "Expected 400 status code for invalid receipt")
 }
 
+// A missing amount is not read as 0.00, on every route that accepts receipts
+func TestProcessReceipt_MissingAmounts(t *testing.T) {
+	noTotal := `{"retailer":"Target","purchaseDate":"2022-01-02","purchaseTime":"13:13","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}]}`
+	noPrice := `{"retailer":"Target","purchaseDate":"2022-01-02","purchaseTime":"13:13","items":[{"shortDescription":"Pepsi - 12-oz"}],"total":"1.25"}`
+	receipts := store.NewMemoryStore()
+	test_router := newTestRouter(t, router.Config{Receipts: receipts})
+	post := func(url string, contentType string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		test_router.ServeHTTP(w, req)
+		return w
+	}
+
+	for name, receipt := range map[string]string{"total": noTotal, "price": noPrice} {
+		w := post("/receipts/process", "application/json", receipt)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400 without a %s", name)
+
+		w = post("/receipts/batch", "application/json", `{"receipts":[`+receipt+`]}`)
+		assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+		var batch batchResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &batch))
+		assert.Equal(t, 1, batch.Rejected, "Batch receipts without a %s should be rejected", name)
+
+		w = post("/receipts/stream", "application/x-ndjson", receipt+"\n")
+		var result streamResult
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		assert.NotNil(t, result.Error, "Streamed receipts without a %s should be rejected", name)
+	}
+
+	count, err := receipts.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
 func TestGetReceiptsPoints_ValidID_01(t *testing.T) {
 	receipt := models.Receipt{
 		Retailer:     "Target",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: models.MustParseDate("2022-01-01"),
+		PurchaseTime: models.MustParseTimeOfDay("13:01"),
 		Items: []models.Item{
-			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
-			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
-			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
-			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
-			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+			{ShortDescription: "Mountain Dew 12PK", Price: models.MustParseMoney("6.49")},
+			{ShortDescription: "Emils Cheese Pizza", Price: models.MustParseMoney("12.25")},
+			{ShortDescription: "Knorr Creamy Chicken", Price: models.MustParseMoney("1.26")},
+			{ShortDescription: "Doritos Nacho Cheese", Price: models.MustParseMoney("3.35")},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: models.MustParseMoney("12.00")},
 		},
-		Total: "35.35",
+		Total: models.MustParseMoney("35.35"),
 	}
 
 	receiptID, err := attemptProcessReceipt(t, receipt)
@@ -301,15 +362,15 @@ func TestGetReceiptsPoints_ValidID_01(t *testing.T) {
 func TestGetReceiptsPoints_ValidID_02(t *testing.T) {
 	receipt := models.Receipt{
 		Retailer:     "M&M Corner Market",
-		PurchaseDate: "2022-03-20",
-		PurchaseTime: "14:33",
+		PurchaseDate: models.MustParseDate("2022-03-20"),
+		PurchaseTime: models.MustParseTimeOfDay("14:33"),
 		Items: []models.Item{
-			{ShortDescription: "Gatorade", Price: "2.25"},
-			{ShortDescription: "Gatorade", Price: "2.25"},
-			{ShortDescription: "Gatorade", Price: "2.25"},
-			{ShortDescription: "Gatorade", Price: "2.25"},
+			{ShortDescription: "Gatorade", Price: models.MustParseMoney("2.25")},
+			{ShortDescription: "Gatorade", Price: models.MustParseMoney("2.25")},
+			{ShortDescription: "Gatorade", Price: models.MustParseMoney("2.25")},
+			{ShortDescription: "Gatorade", Price: models.MustParseMoney("2.25")},
 		},
-		Total: "9.00",
+		Total: models.MustParseMoney("9.00"),
 	}
 
 	receiptID, err := attemptProcessReceipt(t, receipt)
@@ -329,13 +390,13 @@ func TestGetReceiptsPoints_ValidID_03(t *testing.T) {
 	// First, process a receipt to get a valid ID
 	receipt := models.Receipt{
 		Retailer:     "Walgreens",
-		PurchaseDate: "2022-01-02",
-		PurchaseTime: "08:13",
+		PurchaseDate: models.MustParseDate("2022-01-02"),
+		PurchaseTime: models.MustParseTimeOfDay("08:13"),
 		Items: []models.Item{
-			{ShortDescription: "Pepsi - 12-oz", Price: "1.25"},
-			{ShortDescription: "Dasani", Price: "1.40"},
+			{ShortDescription: "Pepsi - 12-oz", Price: models.MustParseMoney("1.25")},
+			{ShortDescription: "Dasani", Price: models.MustParseMoney("1.40")},
 		},
-		Total: "2.65",
+		Total: models.MustParseMoney("2.65"),
 	}
 
 	receiptID, err := attemptProcessReceipt(t, receipt)
@@ -355,12 +416,12 @@ func TestGetReceiptsPoints_ValidID_04(t *testing.T) {
 	// First, process a receipt to get a valid ID
 	receipt := models.Receipt{
 		Retailer:     "Target",
-		PurchaseDate: "2022-01-02",
-		PurchaseTime: "13:13",
+		PurchaseDate: models.MustParseDate("2022-01-02"),
+		PurchaseTime: models.MustParseTimeOfDay("13:13"),
 		Items: []models.Item{
-			{ShortDescription: "Pepsi - 12-oz", Price: "1.25"},
+			{ShortDescription: "Pepsi - 12-oz", Price: models.MustParseMoney("1.25")},
 		},
-		Total: "1.25",
+		Total: models.MustParseMoney("1.25"),
 	}
 
 	receiptID, err := attemptProcessReceipt(t, receipt)
@@ -374,3 +435,1024 @@ func TestGetReceiptsPoints_ValidID_04(t *testing.T) {
 	}
 	assert.Equal(t, int64(31), points, "Expected 31 points for this receipt")
 }
+
+func TestGetReceiptsPointsBreakdown(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:     "M&M Corner Market",
+		PurchaseDate: models.MustParseDate("2022-03-20"),
+		PurchaseTime: models.MustParseTimeOfDay("14:33"),
+		Items: []models.Item{
+			{ShortDescription: "Gatorade", Price: models.MustParseMoney("2.25")},
+			{ShortDescription: "Gatorade", Price: models.MustParseMoney("2.25")},
+			{ShortDescription: "Gatorade", Price: models.MustParseMoney("2.25")},
+			{ShortDescription: "Gatorade", Price: models.MustParseMoney("2.25")},
+		},
+		Total: models.MustParseMoney("9.00"),
+	}
+
+	receiptID, err := attemptProcessReceipt(t, receipt)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+
+	w, err := makeRequest(t, "GET", fmt.Sprintf("/receipts/%s/points/breakdown", receiptID), nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+
+	var breakdown models.PointsBreakdown
+	err = json.Unmarshal(w.Body.Bytes(), &breakdown)
+	assert.NoError(t, err, "Error in unmarshaling JSON response")
+	assert.Equal(t, int64(109), breakdown.Points, "Expected 109 points for this receipt")
+
+	total := int64(0)
+	for _, rule := range breakdown.Rules {
+		assert.NotEmpty(t, rule.Reason, "Rule %s should explain its points", rule.Rule)
+		total += rule.Points
+	}
+	assert.Equal(t, breakdown.Points, total, "Rule points should add up to the total")
+}
+
+func TestGetReceiptsPointsBreakdown_NotFound(t *testing.T) {
+	w, err := makeRequest(t, "GET", "/receipts/adb6b560-0eef-42bc-9d16-df48f30e89b2/points/breakdown", nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusNotFound, w.Code, "Expected status code 404 for Not Found")
+}
+
+// Registry with the default rules as version 1 and a version 2 that only
+// awards points for the retailer name
+func createVersionedRules(t *testing.T, current int) *models.RuleRegistry {
+	v2 := models.DefaultRuleSet()
+	v2.Version = 2
+	v2.Rules = v2.Rules[:1]
+	registry, err := models.NewRuleRegistry(current, models.DefaultRuleSet(), v2)
+	if err != nil {
+		t.Fatalf("Error creating rule registry: %v", err)
+	}
+	return registry
+}
+
+func TestGetReceiptsPoints_PinnedRuleVersion(t *testing.T) {
+	receipts := store.NewMemoryStore()
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: models.MustParseDate("2022-01-02"),
+		PurchaseTime: models.MustParseTimeOfDay("13:13"),
+		Items: []models.Item{
+			{ShortDescription: "Pepsi - 12-oz", Price: models.MustParseMoney("1.25")},
+		},
+		Total: models.MustParseMoney("1.25"),
+	}
+
+	w, err := makeRequestWithConfig(t, router.Config{Receipts: receipts, Rules: createVersionedRules(t, 1)}, "POST", "/receipts/process", receipt)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	// Rules move on to version 2 after the receipt was accepted
+	updated := router.Config{Receipts: receipts, Rules: createVersionedRules(t, 2)}
+	var response struct {
+		Points      int64 `json:"points"`
+		RuleVersion int   `json:"ruleVersion"`
+	}
+
+	w, err = makeRequestWithConfig(t, updated, "GET", fmt.Sprintf("/receipts/%s/points", created.ID), nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, int64(31), response.Points, "Points should stay pinned to version 1")
+	assert.Equal(t, 1, response.RuleVersion)
+
+	w, err = makeRequestWithConfig(t, updated, "GET", fmt.Sprintf("/receipts/%s/points?ruleVersion=2", created.ID), nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, int64(6), response.Points, "Points should be rescored under version 2")
+	assert.Equal(t, 2, response.RuleVersion)
+
+	w, err = makeRequestWithConfig(t, updated, "GET", fmt.Sprintf("/receipts/%s/points/breakdown", created.ID), nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	var breakdown models.PointsBreakdown
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &breakdown))
+	assert.Equal(t, int64(31), breakdown.Points, "Breakdown should use the pinned version")
+	assert.Equal(t, 1, breakdown.RuleVersion)
+}
+
+func TestGetReceiptsPoints_UnknownRuleVersion(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: models.MustParseDate("2022-01-02"),
+		PurchaseTime: models.MustParseTimeOfDay("13:13"),
+		Items: []models.Item{
+			{ShortDescription: "Pepsi - 12-oz", Price: models.MustParseMoney("1.25")},
+		},
+		Total: models.MustParseMoney("1.25"),
+	}
+	receiptID, err := attemptProcessReceipt(t, receipt)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+
+	for _, query := range []string{"ruleVersion=9", "ruleVersion=0", "ruleVersion=abc"} {
+		w, err := makeRequest(t, "GET", fmt.Sprintf("/receipts/%s/points?%s", receiptID, query), nil)
+		if err != nil {
+			t.Fatalf("Error making request: %v", err)
+		}
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400 for %s", query)
+	}
+}
+
+func TestProcessReceipt_Invalid_NumericPrice(t *testing.T) {
+	receipt := gin.H{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": []gin.H{
+			{"shortDescription": "Mountain Dew 12PK", "price": 6.49},
+		},
+		"total": "6.49",
+	}
+
+	w, err := makeRequest(t, "POST", "/receipts/process", receipt)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expected 400 status code for a price that is not a string")
+}
+
+func TestProcessReceipt_Consistency(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: models.MustParseDate("2022-01-02"),
+		PurchaseTime: models.MustParseTimeOfDay("13:13"),
+		Items: []models.Item{
+			{ShortDescription: "Pepsi - 12-oz", Price: models.MustParseMoney("1.25")},
+			{ShortDescription: "Dasani", Price: models.MustParseMoney("1.40")},
+		},
+		Total: models.MustParseMoney("3.00"),
+	}
+
+	// Flagged receipts are accepted and marked on the stored record
+	receipts := store.NewMemoryStore()
+	flag := router.Config{Receipts: receipts, Consistency: models.ConsistencyPolicy{Mode: models.ConsistencyFlag}}
+	w, err := makeRequestWithConfig(t, flag, "POST", "/receipts/process", receipt)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200 when flagging")
+	var created struct {
+		ID string `json:"id"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	record, err := receipts.Get(context.Background(), created.ID)
+	assert.NoError(t, err)
+	assert.True(t, record.Inconsistent, "Receipt should be flagged as inconsistent")
+
+	// Strict mode rejects the receipt and explains the mismatch
+	strict := router.Config{Receipts: receipts, Consistency: models.ConsistencyPolicy{Mode: models.ConsistencyStrict}}
+	w, err = makeRequestWithConfig(t, strict, "POST", "/receipts/process", receipt)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400 in strict mode")
+	var rejected struct {
+		Details models.ConsistencyResult `json:"details"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rejected))
+	assert.Equal(t, models.MustParseMoney("2.65"), rejected.Details.ItemsTotal)
+	assert.Equal(t, models.MustParseMoney("0.35"), rejected.Details.Difference)
+
+	// A tax allowance covers the difference
+	strict.Consistency.TaxRate = 1500 // 15%
+	w, err = makeRequestWithConfig(t, strict, "POST", "/receipts/process", receipt)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200 within the tax allowance")
+}
+
+func TestProcessReceipt_InvalidReceipt_ImpossibleDateTime(t *testing.T) {
+	for _, dateTime := range [][2]string{{"2023-02-30", "13:01"}, {"2023-04-31", "13:01"}, {"2022-01-01", "24:00"}} {
+		receipt := gin.H{
+			"retailer":     "Target",
+			"purchaseDate": dateTime[0],
+			"purchaseTime": dateTime[1],
+			"items": []gin.H{
+				{"shortDescription": "Mountain Dew 12PK", "price": "6.49"},
+			},
+			"total": "6.49",
+		}
+
+		w, err := makeRequest(t, "POST", "/receipts/process", receipt)
+		if err != nil {
+			t.Fatalf("Error making request: %v", err)
+		}
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400 for %s %s", dateTime[0], dateTime[1])
+	}
+}
+
+func TestGetReceipt(t *testing.T) {
+	receipt := models.Receipt{
+		Retailer:     "Target",
+		PurchaseDate: models.MustParseDate("2022-01-02"),
+		PurchaseTime: models.MustParseTimeOfDay("13:13"),
+		Items: []models.Item{
+			{ShortDescription: "Pepsi - 12-oz", Price: models.MustParseMoney("1.25")},
+		},
+		Total: models.MustParseMoney("1.25"),
+	}
+	receiptID, err := attemptProcessReceipt(t, receipt)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+
+	w, err := makeRequest(t, "GET", fmt.Sprintf("/receipts/%s", receiptID), nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+
+	var response struct {
+		ID          string         `json:"id"`
+		Receipt     models.Receipt `json:"receipt"`
+		IngestedAt  time.Time      `json:"ingestedAt"`
+		Points      int64          `json:"points"`
+		RuleVersion int            `json:"ruleVersion"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, receiptID, response.ID)
+	assert.Equal(t, receipt, response.Receipt, "Receipt should be returned as it was submitted")
+	assert.WithinDuration(t, time.Now(), response.IngestedAt, time.Minute)
+	assert.Equal(t, int64(31), response.Points)
+	assert.Equal(t, 1, response.RuleVersion)
+}
+
+func TestGetReceipt_NotFound(t *testing.T) {
+	for _, id := range []string{"00000000-0000-0000-0000-000000000000", "not-a-uuid"} {
+		w, err := makeRequest(t, "GET", fmt.Sprintf("/receipts/%s", id), nil)
+		if err != nil {
+			t.Fatalf("Error making request: %v", err)
+		}
+		assert.Equal(t, http.StatusNotFound, w.Code, "Expected status code 404 for %s", id)
+	}
+}
+
+type listResponse struct {
+	Receipts []struct {
+		ID      string         `json:"id"`
+		Receipt models.Receipt `json:"receipt"`
+		Points  int64          `json:"points"`
+	} `json:"receipts"`
+	NextCursor string `json:"nextCursor"`
+}
+
+func createListTestStore(t *testing.T) router.Config {
+	cfg := router.Config{Receipts: store.NewMemoryStore()}
+	for i, retailer := range []string{"Target", "Walgreens", "Target", "M&M Corner Market", "Target"} {
+		receipt := models.Receipt{
+			Retailer:     retailer,
+			PurchaseDate: models.MustParseDate(fmt.Sprintf("2022-01-%02d", i+1)),
+			PurchaseTime: models.MustParseTimeOfDay("13:13"),
+			Items: []models.Item{
+				{ShortDescription: "Pepsi - 12-oz", Price: models.MustParseMoney(fmt.Sprintf("%d.00", i+1))},
+			},
+			Total: models.MustParseMoney(fmt.Sprintf("%d.00", i+1)),
+		}
+		w, err := makeRequestWithConfig(t, cfg, "POST", "/receipts/process", receipt)
+		if err != nil || w.Code != http.StatusOK {
+			t.Fatalf("Error processing receipt: %v", err)
+		}
+	}
+	return cfg
+}
+
+func listReceipts(t *testing.T, cfg router.Config, query string) listResponse {
+	w, err := makeRequestWithConfig(t, cfg, "GET", "/receipts?"+query, nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200 for %s", query)
+	var response listResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestListReceipts_Filters(t *testing.T) {
+	cfg := createListTestStore(t)
+
+	assert.Len(t, listReceipts(t, cfg, "").Receipts, 5)
+	assert.Len(t, listReceipts(t, cfg, "retailer=target").Receipts, 3)
+	assert.Len(t, listReceipts(t, cfg, "purchaseDateFrom=2022-01-02&purchaseDateTo=2022-01-04").Receipts, 3)
+	assert.Len(t, listReceipts(t, cfg, "minTotal=2.00&maxTotal=3.00").Receipts, 2)
+
+	response := listReceipts(t, cfg, "minPoints=88")
+	assert.Len(t, response.Receipts, 1, "Only the M&M receipt earns at least 88 points")
+	assert.Equal(t, "M&M Corner Market", response.Receipts[0].Receipt.Retailer)
+}
+
+func TestListReceipts_SortAndPaginate(t *testing.T) {
+	cfg := createListTestStore(t)
+
+	dates := []string{}
+	query := "sort=purchaseDate&order=desc&limit=2"
+	for pages := 0; ; pages++ {
+		assert.Less(t, pages, 3, "Expected three pages")
+		response := listReceipts(t, cfg, query)
+		for _, r := range response.Receipts {
+			dates = append(dates, r.Receipt.PurchaseDate.String())
+		}
+		if response.NextCursor == "" {
+			break
+		}
+		query = "sort=purchaseDate&order=desc&limit=2&cursor=" + response.NextCursor
+	}
+	assert.Equal(t, []string{"2022-01-05", "2022-01-04", "2022-01-03", "2022-01-02", "2022-01-01"}, dates)
+
+	response := listReceipts(t, cfg, "sort=points&order=desc&limit=1")
+	assert.Equal(t, "M&M Corner Market", response.Receipts[0].Receipt.Retailer)
+}
+
+func TestListReceipts_InvalidQuery(t *testing.T) {
+	cfg := createListTestStore(t)
+	response := listReceipts(t, cfg, "sort=points&limit=1")
+
+	for _, query := range []string{
+		"sort=total", "order=up", "limit=0", "limit=101", "minTotal=1", "purchaseDateFrom=2023-02-30",
+		"minPoints=-1", "cursor=abc", "sort=purchaseDate&cursor=" + response.NextCursor,
+	} {
+		w, err := makeRequestWithConfig(t, cfg, "GET", "/receipts?"+query, nil)
+		if err != nil {
+			t.Fatalf("Error making request: %v", err)
+		}
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400 for %s", query)
+	}
+}
+
+func createEditTestReceipt(t *testing.T, cfg router.Config) string {
+	receipt := models.Receipt{
+		Retailer:     "Trget",
+		PurchaseDate: models.MustParseDate("2022-01-02"),
+		PurchaseTime: models.MustParseTimeOfDay("13:13"),
+		Items: []models.Item{
+			{ShortDescription: "Pepsi - 12-oz", Price: models.MustParseMoney("1.25")},
+		},
+		Total: models.MustParseMoney("1.25"),
+	}
+	w, err := makeRequestWithConfig(t, cfg, "POST", "/receipts/process", receipt)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	return created.ID
+}
+
+type historyResponse struct {
+	Deleted   bool             `json:"deleted"`
+	Revisions []store.Revision `json:"revisions"`
+}
+
+func getHistory(t *testing.T, cfg router.Config, id string) historyResponse {
+	w, err := makeRequestWithConfig(t, cfg, "GET", fmt.Sprintf("/receipts/%s/history", id), nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+	var history historyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	return history
+}
+
+func TestReplaceReceipt(t *testing.T) {
+	cfg := router.Config{Receipts: store.NewMemoryStore()}
+	id := createEditTestReceipt(t, cfg)
+
+	corrected := gin.H{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-02",
+		"purchaseTime": "13:13",
+		"items": []gin.H{
+			{"shortDescription": "Pepsi - 12-oz", "price": "1.25"},
+		},
+		"total": "1.25",
+	}
+	w, err := makeRequestWithConfig(t, cfg, "PUT", fmt.Sprintf("/receipts/%s", id), corrected)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+
+	var updated struct {
+		Receipt models.Receipt `json:"receipt"`
+		Points  int64          `json:"points"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+	assert.Equal(t, "Target", updated.Receipt.Retailer)
+	assert.Equal(t, int64(31), updated.Points, "Points should be rescored")
+
+	history := getHistory(t, cfg, id)
+	assert.Len(t, history.Revisions, 2)
+	assert.Equal(t, store.RevisionCreate, history.Revisions[0].Action)
+	assert.Equal(t, "Trget", history.Revisions[0].Receipt.Retailer)
+	assert.Equal(t, int64(30), history.Revisions[0].Points)
+	assert.Equal(t, store.RevisionReplace, history.Revisions[1].Action)
+	assert.Equal(t, 2, history.Revisions[1].Revision)
+
+	// Replacements are validated like new receipts
+	corrected["purchaseDate"] = "2022-02-30"
+	w, err = makeRequestWithConfig(t, cfg, "PUT", fmt.Sprintf("/receipts/%s", id), corrected)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400")
+	assert.Len(t, getHistory(t, cfg, id).Revisions, 2, "Rejected changes should not be recorded")
+}
+
+func TestPatchReceipt(t *testing.T) {
+	cfg := router.Config{Receipts: store.NewMemoryStore()}
+	id := createEditTestReceipt(t, cfg)
+
+	w, err := makeRequestWithConfig(t, cfg, "PATCH", fmt.Sprintf("/receipts/%s", id), gin.H{"retailer": "Target"})
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+
+	w, err = makeRequestWithConfig(t, cfg, "GET", fmt.Sprintf("/receipts/%s/points", id), nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	var points struct {
+		Points int64 `json:"points"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &points))
+	assert.Equal(t, int64(31), points.Points, "Points should be rescored")
+
+	history := getHistory(t, cfg, id)
+	assert.Len(t, history.Revisions, 2)
+	assert.Equal(t, store.RevisionPatch, history.Revisions[1].Action)
+	assert.Len(t, history.Revisions[1].Receipt.Items, 1, "Fields missing from the patch should be kept")
+
+	// Removing a required field fails validation
+	for _, patch := range []interface{}{gin.H{"purchaseTime": nil}, gin.H{"total": nil}, gin.H{"total": "1"}, "not an object"} {
+		w, err = makeRequestWithConfig(t, cfg, "PATCH", fmt.Sprintf("/receipts/%s", id), patch)
+		if err != nil {
+			t.Fatalf("Error making request: %v", err)
+		}
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400 for %v", patch)
+	}
+}
+
+func TestUpdateReceipt_Duplicates(t *testing.T) {
+	for _, policy := range []models.DuplicatePolicy{models.DuplicateFlag, models.DuplicateReject} {
+		cfg := router.Config{Receipts: store.NewMemoryStore(), Duplicates: policy}
+		id := createEditTestReceipt(t, cfg)
+		w, err := makeRequestWithConfig(t, cfg, "POST", "/receipts/process", json.RawMessage(streamTestReceipt))
+		assert.NoError(t, err)
+		var original struct {
+			ID string `json:"id"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &original))
+
+		// A receipt never duplicates itself
+		w, err = makeRequestWithConfig(t, cfg, "PATCH", fmt.Sprintf("/receipts/%s", original.ID), gin.H{"total": "1.25"})
+		assert.NoError(t, err)
+		assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200 for policy %s", policy)
+		var updated struct {
+			DuplicateOf string `json:"duplicateOf"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+		assert.Empty(t, updated.DuplicateOf)
+
+		// Correcting the retailer makes the receipt match the other one
+		w, err = makeRequestWithConfig(t, cfg, "PATCH", fmt.Sprintf("/receipts/%s", id), gin.H{"retailer": "Target"})
+		assert.NoError(t, err)
+		if policy == models.DuplicateReject {
+			assert.Equal(t, http.StatusConflict, w.Code, "Expected status code 409")
+			assert.Len(t, getHistory(t, cfg, id).Revisions, 1, "Rejected changes should not be recorded")
+			continue
+		}
+		assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &updated))
+		assert.Equal(t, original.ID, updated.DuplicateOf)
+		record, err := cfg.Receipts.Get(context.Background(), id)
+		assert.NoError(t, err)
+		assert.Equal(t, original.ID, record.DuplicateOf)
+	}
+}
+
+func TestDeleteReceipt(t *testing.T) {
+	cfg := router.Config{Receipts: store.NewMemoryStore()}
+	id := createEditTestReceipt(t, cfg)
+
+	w, err := makeRequestWithConfig(t, cfg, "DELETE", fmt.Sprintf("/receipts/%s", id), nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusNoContent, w.Code, "Expected status code 204")
+
+	for _, request := range [][2]string{
+		{"GET", fmt.Sprintf("/receipts/%s", id)},
+		{"GET", fmt.Sprintf("/receipts/%s/points", id)},
+		{"DELETE", fmt.Sprintf("/receipts/%s", id)},
+	} {
+		w, err = makeRequestWithConfig(t, cfg, request[0], request[1], nil)
+		if err != nil {
+			t.Fatalf("Error making request: %v", err)
+		}
+		assert.Equal(t, http.StatusNotFound, w.Code, "Expected status code 404 for %s %s", request[0], request[1])
+	}
+	assert.Empty(t, listReceipts(t, cfg, "").Receipts, "Deleted receipts should not be listed")
+
+	history := getHistory(t, cfg, id)
+	assert.True(t, history.Deleted)
+	assert.Len(t, history.Revisions, 2)
+	assert.Equal(t, store.RevisionDelete, history.Revisions[1].Action)
+	assert.Nil(t, history.Revisions[1].Receipt)
+}
+
+type batchResponse struct {
+	Accepted int `json:"accepted"`
+	Rejected int `json:"rejected"`
+	Results  []struct {
+		Index int    `json:"index"`
+		ID    string `json:"id"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	} `json:"results"`
+}
+
+func createBatchTestReceipts() []interface{} {
+	valid := gin.H{
+		"retailer":     "Target",
+		"purchaseDate": "2022-01-02",
+		"purchaseTime": "13:13",
+		"items": []gin.H{
+			{"shortDescription": "Pepsi - 12-oz", "price": "1.25"},
+		},
+		"total": "1.25",
+	}
+	invalid := gin.H{
+		"retailer":     "Target",
+		"purchaseDate": "2022-02-30",
+		"purchaseTime": "13:13",
+		"items": []gin.H{
+			{"shortDescription": "Pepsi - 12-oz", "price": "1.25"},
+		},
+		"total": "1.25",
+	}
+	return []interface{}{valid, invalid, valid, "not a receipt"}
+}
+
+func TestProcessBatch_Partial(t *testing.T) {
+	cfg := router.Config{Receipts: store.NewMemoryStore()}
+	w, err := makeRequestWithConfig(t, cfg, "POST", "/receipts/batch", gin.H{"receipts": createBatchTestReceipts()})
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+
+	var response batchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.Accepted)
+	assert.Equal(t, 2, response.Rejected)
+	assert.Len(t, response.Results, 4)
+	for i, result := range response.Results {
+		assert.Equal(t, i, result.Index)
+		if i%2 == 0 {
+			assert.NotEmpty(t, result.ID, "Valid receipt %d should have an id", i)
+			assert.Nil(t, result.Error)
+		} else {
+			assert.Empty(t, result.ID, "Invalid receipt %d should not have an id", i)
+			assert.NotEmpty(t, result.Error.Message)
+		}
+	}
+
+	w, err = makeRequestWithConfig(t, cfg, "GET", fmt.Sprintf("/receipts/%s/points", response.Results[0].ID), nil)
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Batch receipts should be stored")
+}
+
+func TestProcessBatch_Atomic(t *testing.T) {
+	receipts := store.NewMemoryStore()
+	cfg := router.Config{Receipts: receipts}
+	w, err := makeRequestWithConfig(t, cfg, "POST", "/receipts/batch", gin.H{"atomic": true, "receipts": createBatchTestReceipts()})
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400")
+
+	var response batchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 0, response.Accepted)
+	assert.Equal(t, 2, response.Rejected)
+	assert.NotNil(t, response.Results[1].Error)
+	count, err := receipts.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count, "Nothing should be stored when a receipt is invalid")
+
+	w, err = makeRequestWithConfig(t, cfg, "POST", "/receipts/batch", gin.H{"atomic": true, "receipts": createBatchTestReceipts()[:1]})
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+	count, err = receipts.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestProcessBatch_InvalidBody(t *testing.T) {
+	tooMany := make([]interface{}, 1001)
+	for i := range tooMany {
+		tooMany[i] = createBatchTestReceipts()[0]
+	}
+	for _, body := range []interface{}{nil, gin.H{}, gin.H{"receipts": []interface{}{}}, gin.H{"receipts": tooMany}} {
+		w, err := makeRequest(t, "POST", "/receipts/batch", body)
+		if err != nil {
+			t.Fatalf("Error making request: %v", err)
+		}
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400")
+	}
+}
+
+const streamTestReceipt = `{"retailer":"Target","purchaseDate":"2022-01-02","purchaseTime":"13:13","items":[{"shortDescription":"Pepsi - 12-oz","price":"1.25"}],"total":"1.25"}`
+
+type streamResult struct {
+	Line  int    `json:"line"`
+	ID    string `json:"id"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func TestProcessStream(t *testing.T) {
+	receipts := store.NewMemoryStore()
+	test_router := newTestRouter(t, router.Config{Receipts: receipts})
+	body := streamTestReceipt + "\n\n" + `{"retailer":"Target"}` + "\n" + "not json\n" + streamTestReceipt
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/receipts/stream", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	test_router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	results := []streamResult{}
+	decoder := json.NewDecoder(w.Body)
+	for decoder.More() {
+		var result streamResult
+		assert.NoError(t, decoder.Decode(&result))
+		results = append(results, result)
+	}
+	assert.Len(t, results, 4, "Blank lines should be skipped")
+	assert.Equal(t, []int{1, 3, 4, 5}, []int{results[0].Line, results[1].Line, results[2].Line, results[3].Line})
+	assert.NotEmpty(t, results[0].ID)
+	assert.NotNil(t, results[1].Error, "Invalid receipts should be reported")
+	assert.NotNil(t, results[2].Error, "Invalid JSON should be reported")
+	assert.NotEmpty(t, results[3].ID)
+
+	count, err := receipts.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+// Results arrive while the client is still sending, so a stream never has to
+// be held in memory on either side. Validating responses must not get in the
+// way.
+func TestProcessStream_Interleaved(t *testing.T) {
+	for _, validate := range []bool{false, true} {
+		cfg := router.Config{Receipts: store.NewMemoryStore()}
+		if validate {
+			cfg.Spec, cfg.ValidateResponses = apiSpec, true
+		}
+		server := httptest.NewServer(router.SetUpRouter(cfg))
+
+		reader, writer := io.Pipe()
+		req, err := http.NewRequest("POST", server.URL+"/receipts/stream", reader)
+		if err != nil {
+			t.Fatalf("Error creating request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		go writer.Write([]byte(streamTestReceipt + "\n"))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Error making request: %v", err)
+		}
+
+		decoder := json.NewDecoder(resp.Body)
+		for line := 1; line <= 3; line++ {
+			var result streamResult
+			assert.NoError(t, decoder.Decode(&result), "Validating responses: %v", validate)
+			assert.Equal(t, line, result.Line)
+			assert.NotEmpty(t, result.ID)
+			if line < 3 {
+				go writer.Write([]byte(streamTestReceipt + "\n"))
+			}
+		}
+		writer.Close()
+		assert.False(t, decoder.More(), "No results should follow the last line")
+		resp.Body.Close()
+		server.Close()
+	}
+}
+
+func TestProcessStream_WrongContentType(t *testing.T) {
+	w, err := makeRequest(t, "POST", "/receipts/stream", gin.H{})
+	if err != nil {
+		t.Fatalf("Error making request: %v", err)
+	}
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code, "Expected status code 415")
+}
+
+func TestImportReceipts(t *testing.T) {
+	receipts := store.NewMemoryStore()
+	test_router := newTestRouter(t, router.Config{Receipts: receipts})
+	body := `Receipt No,retailer,purchase_date,purchase_time,total,short_description,price
+A,Target,2022-01-01,13:01,18.74,Mountain Dew 12PK,6.49
+A,Target,2022-01-01,13:01,18.74,Emils Cheese Pizza,12.25
+B,Walgreens,2022-01-02,08:13,1.25,Pepsi - 12-oz!,1.25
+`
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/receipts/import?key=Receipt+No", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	test_router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+
+	var report struct {
+		Imported int `json:"imported"`
+		Rejected int `json:"rejected"`
+		Results  []struct {
+			ID     string `json:"id"`
+			Errors []struct {
+				Row    int    `json:"row"`
+				Column string `json:"column"`
+			} `json:"errors"`
+		} `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, 1, report.Rejected)
+	assert.Equal(t, 4, report.Results[1].Errors[0].Row)
+	assert.Equal(t, "short_description", report.Results[1].Errors[0].Column)
+
+	record, err := receipts.Get(context.Background(), report.Results[0].ID)
+	assert.NoError(t, err)
+	assert.Len(t, record.Items, 2)
+	assert.Equal(t, int64(20), record.Points)
+
+	// The default key column is missing without the mapping
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/receipts/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	test_router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400")
+}
+
+func TestProcessReceipt_IdempotencyKey(t *testing.T) {
+	receipts := store.NewMemoryStore()
+	test_router := newTestRouter(t, router.Config{Receipts: receipts})
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "7c4a8d09-retry")
+		test_router.ServeHTTP(w, req)
+		return w
+	}
+
+	first := send(streamTestReceipt)
+	retry := send(streamTestReceipt)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String(), "Retries should return the same id")
+	count, err := receipts.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count, "Retries should not store the receipt again")
+
+	changed := send(strings.Replace(streamTestReceipt, "Target", "Walgreens", 1))
+	assert.Equal(t, http.StatusUnprocessableEntity, changed.Code, "Expected status code 422")
+}
+
+func TestProcessReceipt_Duplicates(t *testing.T) {
+	var receipt map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(streamTestReceipt), &receipt))
+	// Case and spacing of the retailer do not make a receipt new
+	resubmitted := map[string]interface{}{}
+	for key, value := range receipt {
+		resubmitted[key] = value
+	}
+	resubmitted["retailer"] = " TARGET "
+
+	for _, test := range []struct {
+		policy models.DuplicatePolicy
+		status int
+	}{
+		{models.DuplicateAllow, http.StatusOK},
+		{models.DuplicateFlag, http.StatusOK},
+		{models.DuplicateReject, http.StatusConflict},
+	} {
+		t.Run(string(test.policy), func(t *testing.T) {
+			cfg := router.Config{Receipts: store.NewMemoryStore(), Duplicates: test.policy}
+			w, err := makeRequestWithConfig(t, cfg, "POST", "/receipts/process", receipt)
+			assert.NoError(t, err)
+			assert.Equal(t, http.StatusOK, w.Code)
+			var first struct {
+				ID string `json:"id"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+
+			w, err = makeRequestWithConfig(t, cfg, "POST", "/receipts/process", resubmitted)
+			assert.NoError(t, err)
+			assert.Equal(t, test.status, w.Code, "Unexpected status code")
+			var second struct {
+				ID string `json:"id"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &second))
+			if test.policy == models.DuplicateReject {
+				assert.Equal(t, first.ID, second.ID, "The conflict should name the stored receipt")
+				return
+			}
+
+			record, err := cfg.Receipts.Get(context.Background(), second.ID)
+			assert.NoError(t, err)
+			if test.policy == models.DuplicateFlag {
+				assert.Equal(t, first.ID, record.DuplicateOf, "The duplicate should be flagged")
+			} else {
+				assert.Empty(t, record.DuplicateOf, "Duplicates should not be flagged")
+			}
+		})
+	}
+}
+
+func TestProcessBatch_Duplicates(t *testing.T) {
+	receipts := []interface{}{json.RawMessage(streamTestReceipt), json.RawMessage(streamTestReceipt)}
+
+	cfg := router.Config{Receipts: store.NewMemoryStore(), Duplicates: models.DuplicateReject}
+	w, err := makeRequestWithConfig(t, cfg, "POST", "/receipts/batch", gin.H{"atomic": true, "receipts": receipts})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Atomic batches with duplicates should be rejected")
+	count, err := cfg.Receipts.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count, "Nothing should be stored")
+
+	w, err = makeRequestWithConfig(t, cfg, "POST", "/receipts/batch", gin.H{"receipts": receipts})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		Results []struct {
+			ID    string `json:"id"`
+			Error *struct {
+				DuplicateOf string `json:"duplicateOf"`
+			} `json:"error"`
+		} `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Results, 2)
+	assert.Nil(t, response.Results[0].Error)
+	if assert.NotNil(t, response.Results[1].Error) {
+		assert.Equal(t, response.Results[0].ID, response.Results[1].Error.DuplicateOf)
+	}
+}
+
+// Stores a receipt from another request during the batch's duplicate checks
+type racingStore struct {
+	store.ReceiptStore
+	calls  int
+	raceOn int
+	race   store.Record
+}
+
+func (s *racingStore) FindByFingerprint(ctx context.Context, fingerprint string) (string, error) {
+	s.calls++
+	if s.calls == s.raceOn {
+		if err := s.ReceiptStore.Put(ctx, "concurrent", s.race); err != nil {
+			return "", err
+		}
+		return "", store.ErrNotFound
+	}
+	return s.ReceiptStore.FindByFingerprint(ctx, fingerprint)
+}
+
+func TestProcessBatch_AtomicConcurrentDuplicate(t *testing.T) {
+	second := strings.Replace(streamTestReceipt, "13:13", "14:14", 1)
+	var receipt models.Receipt
+	assert.NoError(t, json.Unmarshal([]byte(second), &receipt))
+	receipts := &racingStore{ReceiptStore: store.NewMemoryStore(), raceOn: 2, race: store.Record{Receipt: receipt}}
+	cfg := router.Config{Receipts: receipts, Duplicates: models.DuplicateReject}
+
+	body := gin.H{"atomic": true, "receipts": []interface{}{json.RawMessage(streamTestReceipt), json.RawMessage(second)}}
+	w, err := makeRequestWithConfig(t, cfg, "POST", "/receipts/batch", body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400")
+	var response struct {
+		Results []struct {
+			ID    string `json:"id"`
+			Error *struct {
+				DuplicateOf string `json:"duplicateOf"`
+			} `json:"error"`
+		} `json:"results"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.Len(t, response.Results, 2) {
+		assert.Empty(t, response.Results[0].ID, "Receipts of a rejected batch should not have ids")
+		if assert.NotNil(t, response.Results[1].Error) {
+			assert.Equal(t, "concurrent", response.Results[1].Error.DuplicateOf)
+		}
+	}
+	count, err := receipts.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count, "Only the concurrent receipt should be stored")
+}
+
+// Fails every batch write
+type failingBatchStore struct {
+	store.ReceiptStore
+}
+
+func (s failingBatchStore) PutAll(ctx context.Context, records map[string]store.Record) error {
+	return errors.New("disk full")
+}
+
+func TestProcessBatch_AtomicSaveError(t *testing.T) {
+	receipts := failingBatchStore{ReceiptStore: store.NewMemoryStore()}
+	w, err := makeRequestWithConfig(t, router.Config{Receipts: receipts}, "POST", "/receipts/batch",
+		gin.H{"atomic": true, "receipts": createBatchTestReceipts()[:1]})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, w.Code, "Expected status code 500")
+	count, err := receipts.Count(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestProcessBatch_AtomicFlagsDuplicatesWithinBatch(t *testing.T) {
+	cfg := router.Config{Receipts: store.NewMemoryStore(), Duplicates: models.DuplicateFlag}
+	body := gin.H{"atomic": true, "receipts": []interface{}{json.RawMessage(streamTestReceipt), json.RawMessage(streamTestReceipt)}}
+	w, err := makeRequestWithConfig(t, cfg, "POST", "/receipts/batch", body)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, w.Code, "Expected status code 200")
+	var response batchResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	if assert.Len(t, response.Results, 2) {
+		record, err := cfg.Receipts.Get(context.Background(), response.Results[1].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, response.Results[0].ID, record.DuplicateOf)
+	}
+}
+
+func TestProcessReceipt_SubmittedBy(t *testing.T) {
+	auth, err := middleware.NewAuthenticator([]middleware.APIKey{
+		{Name: "pos-terminals", Hash: middleware.HashAPIKey("pos-key"), Scopes: []string{middleware.ScopeWrite, middleware.ScopeRead}},
+		{Name: "support", Hash: middleware.HashAPIKey("support-key"), Scopes: []string{middleware.ScopeAdmin}},
+	})
+	assert.NoError(t, err)
+	test_router := newTestRouter(t, router.Config{Auth: auth})
+	send := func(method string, url string, key string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "ApiKey "+key)
+		test_router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/receipts/process", "pos-key", streamTestReceipt)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var created struct {
+		ID string `json:"id"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+	w = send("PATCH", "/receipts/"+created.ID, "support-key", `{"retailer": "Walgreens"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send("GET", "/receipts/"+created.ID, "pos-key", "")
+	var stored struct {
+		SubmittedBy string `json:"submittedBy"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &stored))
+	assert.Equal(t, "key:pos-terminals", stored.SubmittedBy, "Corrections should not change the submitter")
+
+	w = send("GET", "/receipts/"+created.ID+"/history", "pos-key", "")
+	var history historyResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	if assert.Len(t, history.Revisions, 2) {
+		assert.Equal(t, "key:pos-terminals", history.Revisions[0].ChangedBy)
+		assert.Equal(t, "key:support", history.Revisions[1].ChangedBy)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiyo4476/receipt-processor-challenge/csvimport"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"go.uber.org/zap"
+)
+
+// Imports receipts from a CSV with one row per item. The columns holding each
+// field can be renamed with query parameters, such as ?key=Receipt+Number.
+func (h *Handler) ImportReceipts(c *gin.Context) {
+	if c.ContentType() != "text/csv" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":   "Failed to import receipts",
+			"message": "body must be text/csv",
+		})
+		return
+	}
+	mapping := csvimport.DefaultMapping()
+	if err := c.ShouldBindQuery(&mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to import receipts", "message": err.Error()})
+		return
+	}
+
+	submittedBy := submitter(c)
+	ingest := func(ctx context.Context, receipt models.Receipt) (string, error) {
+		return h.Ingest(ctx, receipt, submittedBy)
+	}
+	report, err := csvimport.Import(c.Request.Context(), c.Request.Body, mapping, ingest)
+	var rowErr csvimport.RowError
+	if errors.As(err, &rowErr) {
+		zap.L().Warn(fmt.Sprintf("Import Error: %v", err))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to import receipts",
+			"message": rowErr.Error(),
+			"errors":  []csvimport.RowError{rowErr},
+		})
+		return
+	}
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Import Error: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import receipts", "message": err.Error()})
+		return
+	}
+	zap.L().Info(fmt.Sprintf("Imported %d of %d receipts from CSV", report.Imported, report.Receipts))
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
+	"go.uber.org/zap"
+)
+
+type list_receipts_query struct {
+	Retailer         string `form:"retailer"`
+	PurchaseDateFrom string `form:"purchaseDateFrom" binding:"omitempty,correctDate"`
+	PurchaseDateTo   string `form:"purchaseDateTo" binding:"omitempty,correctDate"`
+	MinTotal         string `form:"minTotal" binding:"omitempty,correctCashValue"`
+	MaxTotal         string `form:"maxTotal" binding:"omitempty,correctCashValue"`
+	MinPoints        *int64 `form:"minPoints" binding:"omitempty,min=0"`
+	Sort             string `form:"sort,default=ingestedAt" binding:"oneof=purchaseDate ingestedAt points"`
+	Order            string `form:"order,default=asc" binding:"oneof=asc desc"`
+	Limit            int    `form:"limit,default=20" binding:"min=1,max=100"`
+	Cursor           string `form:"cursor"`
+}
+
+// Position of the last receipt on a page. Receipts are ordered by their sort
+// key and then by id, so the cursor stays valid while receipts are added.
+type list_cursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Key   int64  `json:"k"`
+	ID    string `json:"id"`
+}
+
+func (cur list_cursor) encode() string {
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (list_cursor, error) {
+	var cur list_cursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cur, errors.New("invalid cursor")
+	}
+	if err := json.Unmarshal(data, &cur); err != nil || cur.ID == "" {
+		return cur, errors.New("invalid cursor")
+	}
+	return cur, nil
+}
+
+// Builds the store query for a page of the listing. One receipt more than the
+// page holds is asked for, to tell whether another page follows.
+func parseQuery(query list_receipts_query) (store.ReceiptQuery, error) {
+	q := store.ReceiptQuery{
+		Retailer:   query.Retailer,
+		MinPoints:  query.MinPoints,
+		Sort:       query.Sort,
+		Descending: query.Order == "desc",
+		Limit:      query.Limit + 1,
+	}
+	var err error
+	if query.PurchaseDateFrom != "" {
+		if q.From, err = models.ParseDate(query.PurchaseDateFrom); err != nil {
+			return q, err
+		}
+	}
+	if query.PurchaseDateTo != "" {
+		if q.To, err = models.ParseDate(query.PurchaseDateTo); err != nil {
+			return q, err
+		}
+	}
+	if query.MinTotal != "" {
+		if q.MinTotal, err = models.ParseMoney(query.MinTotal); err != nil {
+			return q, err
+		}
+	}
+	if query.MaxTotal != "" {
+		if q.MaxTotal, err = models.ParseMoney(query.MaxTotal); err != nil {
+			return q, err
+		}
+	}
+	if query.Cursor != "" {
+		cur, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return q, err
+		}
+		if cur.Sort != query.Sort || cur.Order != query.Order {
+			return q, errors.New("cursor was issued for a different sort order")
+		}
+		q.After = &store.Cursor{Key: cur.Key, ID: cur.ID}
+	}
+	return q, nil
+}
+
+// Lists stored receipts matching the query filters, one page at a time
+func (h *Handler) ListReceipts(c *gin.Context) {
+	var query list_receipts_query
+	if err := c.ShouldBindQuery(&query); err != nil {
+		zap.L().Warn(fmt.Sprintf("Validation Error:  %v", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query", "message": err.Error()})
+		return
+	}
+	q, err := parseQuery(query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query", "message": err.Error()})
+		return
+	}
+
+	matches, err := h.Receipts.Query(c.Request.Context(), q)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Error listing receipts: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list receipts", "message": "receipts could not be loaded"})
+		return
+	}
+
+	response := gin.H{}
+	if len(matches) > query.Limit {
+		matches = matches[:query.Limit]
+		last := matches[len(matches)-1].Cursor
+		response["nextCursor"] = list_cursor{Sort: query.Sort, Order: query.Order, Key: last.Key, ID: last.ID}.encode()
+	}
+	receipts := make([]stored_receipt, 0, len(matches))
+	for _, match := range matches {
+		receipts = append(receipts, h.storedReceipt(match.ID, match.Record))
+	}
+	response["receipts"] = receipts
+	c.JSON(http.StatusOK, response)
+}
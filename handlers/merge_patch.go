@@ -0,0 +1,36 @@
+package handlers
+
+import "encoding/json"
+
+// Applies a JSON merge patch (RFC 7396) to a JSON document. Members of the
+// patch replace the matching members of the document, null removes them and
+// anything other than an object replaces the whole value.
+func mergePatch(document []byte, patch []byte) ([]byte, error) {
+	var target, changes interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, err
+	}
+	return json.Marshal(mergeValue(target, changes))
+}
+
+func mergeValue(target interface{}, patch interface{}) interface{} {
+	changes, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	merged, ok := target.(map[string]interface{})
+	if !ok {
+		merged = map[string]interface{}{}
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(merged, name)
+			continue
+		}
+		merged[name] = mergeValue(merged[name], value)
+	}
+	return merged
+}
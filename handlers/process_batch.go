@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/google/uuid"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
+	"go.uber.org/zap"
+)
+
+// The most receipts accepted in one batch
+const maxBatchSize = 1000
+
+type batch_request struct {
+	// When set either every receipt is stored or none are
+	Atomic bool `json:"atomic"`
+	// At most maxBatchSize, checked after binding
+	Receipts []json.RawMessage `json:"receipts" binding:"required,min=1"`
+}
+
+// Outcome for one receipt of a batch, either its id or why it was rejected
+type batch_result struct {
+	Index int        `json:"index"`
+	ID    string     `json:"id,omitempty"`
+	Error *Rejection `json:"error,omitempty"`
+}
+
+// Validates and stores many receipts in one request. Each receipt is checked
+// on its own and the response lists an id or an error for every entry.
+func (h *Handler) ProcessBatch(c *gin.Context) {
+	var request batch_request
+	err := c.ShouldBindJSON(&request)
+	if err == nil && len(request.Receipts) > maxBatchSize {
+		err = fmt.Errorf("%d receipts sent", len(request.Receipts))
+	}
+	if err != nil {
+		zap.L().Warn(fmt.Sprintf("Validation Error: %v", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to process batch",
+			"message": fmt.Sprintf("body must hold between 1 and %d receipts: %v", maxBatchSize, err),
+		})
+		return
+	}
+
+	results := make([]batch_result, len(request.Receipts))
+	records := make([]*store.Record, len(request.Receipts))
+	rejected := 0
+	now := time.Now().UTC()
+	submittedBy := submitter(c)
+	ctx := c.Request.Context()
+	// Duplicates within an atomic batch are found before anything is stored
+	seen := map[string]int{}
+	for i, raw := range request.Receipts {
+		results[i].Index = i
+		var receipt models.Receipt
+		if err := binding.JSON.BindBody(raw, &receipt); err != nil {
+			results[i].Error = &Rejection{Message: err.Error()}
+			rejected++
+			continue
+		}
+		record, reason := h.prepare(receipt)
+		if reason != nil {
+			results[i].Error = reason
+			rejected++
+			continue
+		}
+		if request.Atomic && h.Duplicates == models.DuplicateReject {
+			if reason := h.findDuplicate(ctx, record, seen, i); reason != nil {
+				results[i].Error = reason
+				rejected++
+				continue
+			}
+		}
+		record.CreatedAt = now
+		record.SubmittedBy = submittedBy
+		record.AddRevision(store.RevisionCreate, now, submittedBy)
+		records[i] = &record
+	}
+
+	if request.Atomic && rejected > 0 {
+		zap.L().Warn(fmt.Sprintf("Rejected atomic batch of %d receipts, %d invalid", len(results), rejected))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Failed to process batch",
+			"message":  fmt.Sprintf("%d of %d receipts are invalid, none were stored", rejected, len(results)),
+			"accepted": 0,
+			"rejected": rejected,
+			"results":  results,
+		})
+		return
+	}
+
+	if request.Atomic {
+		h.processAtomicBatch(c, records, results)
+		return
+	}
+
+	accepted := 0
+	for i, record := range records {
+		if record == nil {
+			continue
+		}
+		id, err := h.save(ctx, *record)
+		var duplicate *Rejection
+		if errors.As(err, &duplicate) {
+			results[i].Error = duplicate
+			rejected++
+			continue
+		}
+		if err != nil {
+			zap.L().Error(fmt.Sprintf("Error saving receipt %d of batch: %v", i, err))
+			results[i].Error = &Rejection{Message: "receipt could not be saved"}
+			rejected++
+			continue
+		}
+		results[i].ID = id
+		accepted++
+	}
+	zap.L().Info(fmt.Sprintf("Added %d of %d receipts from batch", accepted, len(results)))
+	c.JSON(http.StatusOK, gin.H{
+		"accepted": accepted,
+		"rejected": rejected,
+		"results":  results,
+	})
+}
+
+// Stores a batch whose receipts all passed validation in one write, so either
+// every receipt is stored or none are
+func (h *Handler) processAtomicBatch(c *gin.Context, records []*store.Record, results []batch_result) {
+	ids, duplicates, err := h.saveAll(c.Request.Context(), records)
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Error saving batch: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to process batch",
+			"message": "receipts could not be saved, none were stored",
+		})
+		return
+	}
+	if duplicates != nil {
+		rejected := 0
+		for i, duplicate := range duplicates {
+			if duplicate != nil {
+				results[i].Error = duplicate
+				rejected++
+			}
+		}
+		// Stored by another request after the batch was checked
+		zap.L().Warn(fmt.Sprintf("Rejected atomic batch of %d receipts, %d are duplicates", len(results), rejected))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Failed to process batch",
+			"message":  fmt.Sprintf("%d of %d receipts are duplicates, none were stored", rejected, len(results)),
+			"accepted": 0,
+			"rejected": rejected,
+			"results":  results,
+		})
+		return
+	}
+	for i, id := range ids {
+		results[i].ID = id
+	}
+	zap.L().Info(fmt.Sprintf("Added %d receipts from atomic batch", len(ids)))
+	c.JSON(http.StatusOK, gin.H{
+		"accepted": len(ids),
+		"rejected": 0,
+		"results":  results,
+	})
+}
+
+// Applies the duplicate policy to every record while holding the fingerprint
+// locks of all of them, then stores the records under fresh ids with one
+// PutAll. Returns the ids in batch order, or when the policy rejects any
+// record the rejection of each record, nil for those that were not rejected.
+func (h *Handler) saveAll(ctx context.Context, records []*store.Record) ([]string, []*Rejection, error) {
+	if h.checksDuplicates() {
+		// Locked in index order so batches and single saves cannot deadlock
+		var locked [len(h.fingerprintLocks)]bool
+		for _, record := range records {
+			locked[h.fingerprintLock(record.Fingerprint())] = true
+		}
+		for i := range h.fingerprintLocks {
+			if locked[i] {
+				h.fingerprintLocks[i].Lock()
+				defer h.fingerprintLocks[i].Unlock()
+			}
+		}
+	}
+
+	ids := make([]string, len(records))
+	batch := make(map[string]store.Record, len(records))
+	var rejections []*Rejection
+	// Ids given to the batch's receipts, by fingerprint
+	earlier := map[string]string{}
+	for i, record := range records {
+		ids[i] = uuid.New().String()
+		if h.checksDuplicates() {
+			fingerprint := record.Fingerprint()
+			existing, err := h.Receipts.FindByFingerprint(ctx, fingerprint)
+			if errors.Is(err, store.ErrNotFound) {
+				existing, err = earlier[fingerprint], nil
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("receipt %d could not be checked for duplicates: %w", i, err)
+			}
+			switch {
+			case existing != "" && h.Duplicates == models.DuplicateReject:
+				if rejections == nil {
+					rejections = make([]*Rejection, len(records))
+				}
+				rejections[i] = duplicateRejection(existing)
+			case existing != "":
+				record.DuplicateOf = existing
+			default:
+				earlier[fingerprint] = ids[i]
+			}
+		}
+		batch[ids[i]] = *record
+	}
+	if rejections != nil {
+		return nil, rejections, nil
+	}
+	if err := h.Receipts.PutAll(ctx, batch); err != nil {
+		return nil, nil, fmt.Errorf("receipts could not be saved: %w", err)
+	}
+	return ids, nil, nil
+}
+
+// Looks for a receipt with the same fingerprint in the store or earlier in the
+// batch. The batch's receipts are added to seen as they are checked.
+func (h *Handler) findDuplicate(ctx context.Context, record store.Record, seen map[string]int, index int) *Rejection {
+	fingerprint := record.Fingerprint()
+	if existing, err := h.Receipts.FindByFingerprint(ctx, fingerprint); err == nil {
+		return duplicateRejection(existing)
+	}
+	if earlier, ok := seen[fingerprint]; ok {
+		return &Rejection{Message: fmt.Sprintf("receipt is a duplicate of receipt %d of the batch", earlier)}
+	}
+	seen[fingerprint] = index
+	return nil
+}
@@ -1,8 +1,11 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-contrib/requestid"
 	"github.com/jiyo4476/receipt-processor-challenge/models"
@@ -14,7 +17,7 @@ import (
 )
 
 // Returns an ID for the receipt
-func ProcessReceipt(c *gin.Context) {
+func (h *Handler) ProcessReceipt(c *gin.Context) {
 	zap.L().Info(fmt.Sprintf("Processing receipt from request %s", requestid.Get(c)))
 	var receipt models.Receipt
 	if err := c.ShouldBindJSON(&receipt); err != nil {
@@ -26,8 +29,147 @@ func ProcessReceipt(c *gin.Context) {
 		return
 	}
 
-	var id = uuid.New().String()
-	store.Receipts[id] = receipt
+	record, ok := h.accept(c, receipt, "Failed to process receipt")
+	if !ok {
+		return
+	}
+	record.CreatedAt = time.Now().UTC()
+	record.SubmittedBy = submitter(c)
+	record.AddRevision(store.RevisionCreate, record.CreatedAt, record.SubmittedBy)
+
+	id, err := h.save(c.Request.Context(), record)
+	var rejected *Rejection
+	if errors.As(err, &rejected) {
+		zap.L().Warn(fmt.Sprintf("Duplicate of receipt %s", rejected.DuplicateOf))
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Duplicate receipt",
+			"message": rejected.Message,
+			"id":      rejected.DuplicateOf,
+		})
+		return
+	}
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Error saving receipt: %v", err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to process receipt",
+			"message": "receipt could not be saved",
+		})
+		return
+	}
 	zap.L().Info(fmt.Sprintf("Added receipt %s to database", id))
 	c.JSON(http.StatusOK, gin.H{"id": id})
 }
+
+// Rejection explains why a receipt that passed binding was not accepted
+type Rejection struct {
+	Message string                    `json:"message"`
+	Details *models.ConsistencyResult `json:"details,omitempty"`
+	// Id of the stored receipt a rejected duplicate matched
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+}
+
+func (r *Rejection) Error() string {
+	return r.Message
+}
+
+// Scores and stores a receipt that has already been validated, for callers
+// outside a request. A receipt that is not accepted returns a *Rejection.
+func (h *Handler) Ingest(ctx context.Context, receipt models.Receipt, submittedBy string) (string, error) {
+	record, rejected := h.prepare(receipt)
+	if rejected != nil {
+		return "", rejected
+	}
+	record.CreatedAt = time.Now().UTC()
+	record.SubmittedBy = submittedBy
+	record.AddRevision(store.RevisionCreate, record.CreatedAt, submittedBy)
+	id, err := h.save(ctx, record)
+	if err != nil {
+		zap.L().Warn(fmt.Sprintf("Error saving receipt: %v", err))
+	}
+	return id, err
+}
+
+// Stores a new record under a fresh id after applying the duplicate policy. A
+// rejected duplicate returns a *Rejection naming the stored receipt.
+func (h *Handler) save(ctx context.Context, record store.Record) (string, error) {
+	if h.checksDuplicates() {
+		fingerprint := record.Fingerprint()
+		lock := &h.fingerprintLocks[h.fingerprintLock(fingerprint)]
+		lock.Lock()
+		defer lock.Unlock()
+
+		existing, err := h.Receipts.FindByFingerprint(ctx, fingerprint)
+		switch {
+		case err == nil && h.Duplicates == models.DuplicateReject:
+			return "", duplicateRejection(existing)
+		case err == nil:
+			record.DuplicateOf = existing
+		case !errors.Is(err, store.ErrNotFound):
+			return "", fmt.Errorf("receipt could not be checked for duplicates: %w", err)
+		}
+	}
+
+	id := uuid.New().String()
+	if err := h.Receipts.Put(ctx, id, record); err != nil {
+		return "", fmt.Errorf("receipt could not be saved: %w", err)
+	}
+	return id, nil
+}
+
+// Index of the lock serializing receipts with the fingerprint
+func (h *Handler) fingerprintLock(fingerprint string) int {
+	return int(fingerprint[0]) % len(h.fingerprintLocks)
+}
+
+// Whether the duplicate policy looks for stored receipts with the same
+// fingerprint
+func (h *Handler) checksDuplicates() bool {
+	return h.Duplicates == models.DuplicateReject || h.Duplicates == models.DuplicateFlag
+}
+
+func duplicateRejection(existing string) *Rejection {
+	return &Rejection{
+		Message:     fmt.Sprintf("receipt was already submitted as %s", existing),
+		DuplicateOf: existing,
+	}
+}
+
+// Checks the consistency of a receipt that passed binding and scores it. When
+// it is rejected the error response has already been written and ok is false.
+func (h *Handler) accept(c *gin.Context, receipt models.Receipt, failure string) (record store.Record, ok bool) {
+	record, rejected := h.prepare(receipt)
+	if rejected != nil {
+		response := gin.H{"error": failure, "message": rejected.Message}
+		if rejected.Details != nil {
+			response["details"] = rejected.Details
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return store.Record{}, false
+	}
+	return record, true
+}
+
+// Like accept but leaves reporting the rejection to the caller
+func (h *Handler) prepare(receipt models.Receipt) (store.Record, *Rejection) {
+	check := h.Consistency.Check(receipt)
+	inconsistent := h.Consistency.Mode != models.ConsistencyOff && !check.Consistent
+	if inconsistent && h.Consistency.Mode == models.ConsistencyStrict {
+		zap.L().Warn(fmt.Sprintf("Consistency Error: total %s does not match items %s", check.Total, check.ItemsTotal))
+		return store.Record{}, &Rejection{Message: "total does not match the sum of the item prices", Details: &check}
+	}
+
+	// Points are pinned to the rules in force when the receipt is accepted
+	rules := h.Rules.Current()
+	points, err := rules.Points(receipt)
+	if err != nil {
+		zap.L().Warn(fmt.Sprintf("Scoring Error: %v", err.Error()))
+		return store.Record{}, &Rejection{Message: err.Error()}
+	}
+	return store.Record{
+		Receipt:     receipt,
+		RuleVersion: rules.Version,
+		Points:      points,
+		// Flagged receipts are kept so they can be reviewed later
+		Inconsistent: inconsistent,
+	}, nil
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"go.uber.org/zap"
+)
+
+// The longest line accepted by the stream endpoint
+const maxStreamLine = 1 << 20
+
+// Outcome for one line of a stream, either the receipt's id or why it was
+// rejected. Lines are numbered from 1.
+type stream_result struct {
+	Line  int        `json:"line"`
+	ID    string     `json:"id,omitempty"`
+	Error *Rejection `json:"error,omitempty"`
+}
+
+// Reads newline delimited JSON receipts and stores them one line at a time.
+// A result line is written back for every receipt as soon as it is handled, so
+// the body is never held in memory.
+func (h *Handler) ProcessStream(c *gin.Context) {
+	if c.ContentType() != "application/x-ndjson" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{
+			"error":   "Failed to process stream",
+			"message": "body must be application/x-ndjson",
+		})
+		return
+	}
+	// Results are written while the body is still being read. HTTP/2 always
+	// allows that, HTTP/1 needs full duplex and without it the results are
+	// held until the whole body has been read.
+	streaming := c.Request.ProtoMajor >= 2
+	if !streaming {
+		if err := http.NewResponseController(c.Writer).EnableFullDuplex(); err != nil {
+			zap.L().Warn(fmt.Sprintf("Error enabling full duplex, results are sent after the body is read: %v", err))
+		} else {
+			streaming = true
+		}
+	}
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	ctx := c.Request.Context()
+	encoder := json.NewEncoder(c.Writer)
+	pending := []stream_result{}
+	send := func(result stream_result) error {
+		if !streaming {
+			pending = append(pending, result)
+			return nil
+		}
+		if err := encoder.Encode(result); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	}
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxStreamLine)
+	line, accepted, rejected := 0, 0, 0
+	for scanner.Scan() {
+		line++
+		if ctx.Err() != nil {
+			break
+		}
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		result := h.ingestLine(c, line, raw)
+		if result.Error != nil {
+			rejected++
+		} else {
+			accepted++
+		}
+		if err := send(result); err != nil {
+			zap.L().Warn(fmt.Sprintf("Error writing stream result: %v", err))
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		message := err.Error()
+		if errors.Is(err, bufio.ErrTooLong) {
+			message = fmt.Sprintf("line is longer than %d bytes, the rest of the stream was not read", maxStreamLine)
+		}
+		send(stream_result{Line: line + 1, Error: &Rejection{Message: message}})
+	}
+	for _, result := range pending {
+		if err := encoder.Encode(result); err != nil {
+			zap.L().Warn(fmt.Sprintf("Error writing stream result: %v", err))
+			return
+		}
+	}
+	zap.L().Info(fmt.Sprintf("Added %d receipts from stream, rejected %d", accepted, rejected))
+}
+
+func (h *Handler) ingestLine(c *gin.Context, line int, raw []byte) stream_result {
+	result := stream_result{Line: line}
+	var receipt models.Receipt
+	if err := binding.JSON.BindBody(raw, &receipt); err != nil {
+		result.Error = &Rejection{Message: err.Error()}
+		return result
+	}
+	id, err := h.Ingest(c.Request.Context(), receipt, submitter(c))
+	var rejected *Rejection
+	switch {
+	case errors.As(err, &rejected):
+		result.Error = rejected
+	case err != nil:
+		result.Error = &Rejection{Message: "receipt could not be saved"}
+	default:
+		result.ID = id
+	}
+	return result
+}
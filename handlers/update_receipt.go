@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
+	"go.uber.org/zap"
+)
+
+// Replaces the receipt with the one in the body and rescores it
+func (h *Handler) ReplaceReceipt(c *gin.Context) {
+	var receipt models.Receipt
+	if err := c.ShouldBindJSON(&receipt); err != nil {
+		zap.L().Warn(fmt.Sprintf("Validation Error: %v", err.Error()))
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Failed to update receipt",
+			"message": err.Error(),
+		})
+		return
+	}
+	h.update(c, store.RevisionReplace, func(existing store.Record) (models.Receipt, bool) {
+		return receipt, true
+	})
+}
+
+// Applies the JSON merge patch in the body to the receipt and rescores it. The
+// patched receipt is validated like a new one.
+func (h *Handler) PatchReceipt(c *gin.Context) {
+	patch, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to update receipt", "message": err.Error()})
+		return
+	}
+	if !json.Valid(patch) {
+		zap.L().Warn("Patch Error: body is not JSON")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to update receipt", "message": "body must be a JSON merge patch"})
+		return
+	}
+
+	h.update(c, store.RevisionPatch, func(existing store.Record) (models.Receipt, bool) {
+		current, err := json.Marshal(existing.Receipt)
+		if err != nil {
+			zap.L().Error(fmt.Sprintf("Error encoding receipt: %v", err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update receipt", "message": "receipt could not be loaded"})
+			return models.Receipt{}, false
+		}
+		patched, err := mergePatch(current, patch)
+		if err != nil {
+			zap.L().Warn(fmt.Sprintf("Patch Error: %v", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to update receipt", "message": "body must be a JSON merge patch"})
+			return models.Receipt{}, false
+		}
+
+		var receipt models.Receipt
+		if err := binding.JSON.BindBody(patched, &receipt); err != nil {
+			zap.L().Warn(fmt.Sprintf("Validation Error: %v", err.Error()))
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Failed to update receipt",
+				"message": err.Error(),
+			})
+			return models.Receipt{}, false
+		}
+		return receipt, true
+	})
+}
+
+// Lock serializing changes to the receipt stored under id, picked by a hash of
+// the id so edits of different receipts rarely wait for each other
+func (h *Handler) editLock(id string) *sync.Mutex {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return &h.editLocks[hash.Sum32()%uint32(len(h.editLocks))]
+}
+
+// Stores the receipt change derives from the existing record as a new revision.
+// The body has already been read, only loading and saving the record holds
+// the receipt's edit lock. When change returns false it has written the
+// error response.
+func (h *Handler) update(c *gin.Context, action string, change func(existing store.Record) (models.Receipt, bool)) {
+	lock := h.editLock(c.Param("id"))
+	lock.Lock()
+	defer lock.Unlock()
+	id, existing, ok := h.findReceipt(c)
+	if !ok {
+		return
+	}
+	receipt, ok := change(existing)
+	if !ok {
+		return
+	}
+
+	record, ok := h.accept(c, receipt, "Failed to update receipt")
+	if !ok {
+		return
+	}
+	record.CreatedAt = existing.CreatedAt
+	record.SubmittedBy = existing.SubmittedBy
+	record.DuplicateOf = existing.DuplicateOf
+	record.Revisions = existing.History()
+	record.AddRevision(action, time.Now().UTC(), submitter(c))
+
+	err := h.saveEdit(c.Request.Context(), id, &record)
+	var rejected *Rejection
+	if errors.As(err, &rejected) {
+		zap.L().Warn(fmt.Sprintf("Change to receipt %s duplicates receipt %s", id, rejected.DuplicateOf))
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Duplicate receipt",
+			"message": rejected.Message,
+			"id":      rejected.DuplicateOf,
+		})
+		return
+	}
+	if err != nil {
+		zap.L().Error(fmt.Sprintf("Error saving receipt %s: %v", id, err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to update receipt",
+			"message": "receipt could not be saved",
+		})
+		return
+	}
+	zap.L().Info(fmt.Sprintf("Updated receipt %s to revision %d", id, len(record.Revisions)))
+	c.JSON(http.StatusOK, h.storedReceipt(id, record))
+}
+
+// Saves a changed record after applying the duplicate policy like save, under
+// the same fingerprint lock, and updates its DuplicateOf. The record is never
+// a duplicate of itself.
+func (h *Handler) saveEdit(ctx context.Context, id string, record *store.Record) error {
+	if h.checksDuplicates() {
+		fingerprint := record.Fingerprint()
+		lock := &h.fingerprintLocks[h.fingerprintLock(fingerprint)]
+		lock.Lock()
+		defer lock.Unlock()
+
+		existing, err := h.Receipts.FindByFingerprint(ctx, fingerprint)
+		switch {
+		case err == nil && existing != id && h.Duplicates == models.DuplicateReject:
+			return duplicateRejection(existing)
+		case err == nil && existing != id:
+			record.DuplicateOf = existing
+		case err == nil || errors.Is(err, store.ErrNotFound):
+			record.DuplicateOf = ""
+		default:
+			return fmt.Errorf("receipt could not be checked for duplicates: %w", err)
+		}
+	}
+
+	if err := h.Receipts.Put(ctx, id, *record); err != nil {
+		return fmt.Errorf("receipt could not be saved: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jiyo4476/receipt-processor-challenge/csvimport"
+	"github.com/jiyo4476/receipt-processor-challenge/handlers"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+)
+
+// Imports a CSV of receipts into the configured store and writes the report
+// to out. Usage: receipt-processor import [-key column ...] file.csv, where a
+// file of - reads from in.
+func runImport(args []string, in io.Reader, out io.Writer) error {
+	mapping := csvimport.DefaultMapping()
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.StringVar(&mapping.Key, "key", mapping.Key, "column holding the receipt key")
+	flags.StringVar(&mapping.Retailer, "retailer", mapping.Retailer, "column holding the retailer")
+	flags.StringVar(&mapping.PurchaseDate, "purchaseDate", mapping.PurchaseDate, "column holding the purchase date")
+	flags.StringVar(&mapping.PurchaseTime, "purchaseTime", mapping.PurchaseTime, "column holding the purchase time")
+	flags.StringVar(&mapping.Total, "total", mapping.Total, "column holding the total")
+	flags.StringVar(&mapping.ShortDescription, "shortDescription", mapping.ShortDescription, "column holding the item description")
+	flags.StringVar(&mapping.Price, "price", mapping.Price, "column holding the item price")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("expected one CSV file, or - for standard input")
+	}
+
+	source := in
+	if name := flags.Arg(0); name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		source = file
+	}
+
+	env := getEnv()
+	receipts, err := getStore(env)
+	if err != nil {
+		return fmt.Errorf("error opening store: %w", err)
+	}
+	defer func() {
+		if closer, ok := receipts.(io.Closer); ok {
+			closer.Close()
+		}
+	}()
+	rules, err := models.LoadRuleRegistry(env.RULES_DIR, env.RULES_VERSION)
+	if err != nil {
+		return fmt.Errorf("error loading rules: %w", err)
+	}
+	consistency := getConsistencyPolicy(env)
+	if err := consistency.Validate(); err != nil {
+		return err
+	}
+
+	duplicates := getDuplicatePolicy(env)
+	if err := duplicates.Validate(); err != nil {
+		return err
+	}
+
+	h := handlers.New(receipts, rules, consistency, duplicates)
+	// Receipts imported from the command line are not attributed to a client
+	ingest := func(ctx context.Context, receipt models.Receipt) (string, error) {
+		return h.Ingest(ctx, receipt, "")
+	}
+	report, err := csvimport.Import(context.Background(), source, mapping, ingest)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -1,27 +1,60 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
 	"time"
 
-	"github.com/gin-contrib/requestid"
-	ginzap "github.com/gin-contrib/zap"
-	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 
+	"github.com/gin-gonic/gin"
 	"github.com/jiyo4476/receipt-processor-challenge/middleware"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
 	"github.com/jiyo4476/receipt-processor-challenge/router"
 	"github.com/jiyo4476/receipt-processor-challenge/spec"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
 	"github.com/kelseyhightower/envconfig"
 )
 
 type environment struct {
-	PORT     string `default:"8080"`
-	HOSTNAME string `default:"localhost"`
+	PORT              string        `default:"8080"`
+	HOSTNAME          string        `default:"localhost"`
+	STORE             string        `default:""`
+	DATA_DIR          string        `default:""`
+	SNAPSHOT_INTERVAL time.Duration `default:"5m"`
+	SQL_DRIVER        string        `default:"sqlite"`
+	SQL_DSN           string        `default:"receipts.db"`
+	RULES_DIR         string        `default:"rules"`
+	RULES_VERSION     int           `default:"0"`
+	// How receipts whose total does not match their items are handled
+	// Empty falls back to models.DefaultConsistencyMode
+	CONSISTENCY_MODE         string            `default:""`
+	CONSISTENCY_TAX_RATE     models.Multiplier `default:"0"`
+	CONSISTENCY_MAX_DISCOUNT models.Money      `default:"0.00"`
+	CONSISTENCY_ROUNDING     models.Money      `default:"0.00"`
+	// How receipts already stored are handled, reject, flag or allow
+	// Empty falls back to models.DefaultDuplicatePolicy
+	DUPLICATE_POLICY models.DuplicatePolicy `default:""`
+	// How long responses are replayed for a repeated Idempotency-Key
+	IDEMPOTENCY_WINDOW time.Duration `default:"24h"`
+	// YAML file of API keys and their scopes, authentication is off when unset
+	API_KEYS_FILE string `default:""`
+	// JSON Web Key Set that bearer tokens are verified against, tokens are
+	// not accepted when unset
+	JWT_JWKS_FILE       string        `default:""`
+	JWT_RELOAD_INTERVAL time.Duration `default:"5m"`
+	JWT_ISSUER          string        `default:""`
+	JWT_AUDIENCE        string        `default:""`
+	JWT_LEEWAY          time.Duration `default:"30s"`
+	// YAML file of per client limits, one request per second for everyone
+	// when unset
+	RATE_LIMIT_FILE string `default:""`
+	// Proxies trusted to report the client IP in X-Forwarded-For
+	TRUSTED_PROXIES []string `default:""`
 }
 
 func getEnv() environment {
@@ -42,31 +75,91 @@ func getLogger() *zap.Logger {
 	return logger
 }
 
-func getServer() *http.Server {
-	env := getEnv()
+// Opens the backend named by STORE. When STORE is unset receipts are kept on
+// disk if a data directory is configured, otherwise in memory.
+func getStore(env environment) (store.ReceiptStore, error) {
+	backend := env.STORE
+	if backend == "" && env.DATA_DIR != "" {
+		backend = "file"
+	}
 
-	cur_router := router.SetUpRouter()
+	switch backend {
+	case "", "memory":
+		zap.L().Warn("Using in-memory store, receipts will be lost on restart")
+		return store.NewMemoryStore(), nil
+	case "file":
+		if env.DATA_DIR == "" {
+			return nil, fmt.Errorf("file store requires RECEIPT_PROCESSOR_DATA_DIR")
+		}
+		return store.OpenFileStore(env.DATA_DIR, env.SNAPSHOT_INTERVAL)
+	case "sql":
+		return store.OpenSQLStore(env.SQL_DRIVER, env.SQL_DSN)
+	default:
+		return nil, fmt.Errorf("unknown store %q, expected memory, file or sql", backend)
+	}
+}
 
-	// Add middleware
-	cur_router.Use(requestid.New())
-	logger := zap.L()
+func getConsistencyPolicy(env environment) models.ConsistencyPolicy {
+	mode := env.CONSISTENCY_MODE
+	if mode == "" {
+		mode = models.DefaultConsistencyMode
+	}
+	return models.ConsistencyPolicy{
+		Mode:        mode,
+		TaxRate:     env.CONSISTENCY_TAX_RATE,
+		MaxDiscount: env.CONSISTENCY_MAX_DISCOUNT,
+		Rounding:    env.CONSISTENCY_ROUNDING,
+	}
+}
 
-	cur_router.Use(ginzap.GinzapWithConfig(logger, &ginzap.Config{
-		UTC:        true,
-		TimeFormat: time.RFC3339,
-		Context: ginzap.Fn(func(c *gin.Context) []zapcore.Field {
-			fields := []zapcore.Field{}
-			// log request ID
-			if requestID := requestid.Get(c); requestID != "" {
-				fields = append(fields, zap.String("request_id", requestID))
-			}
+func getDuplicatePolicy(env environment) models.DuplicatePolicy {
+	if env.DUPLICATE_POLICY == "" {
+		return models.DefaultDuplicatePolicy
+	}
+	return env.DUPLICATE_POLICY
+}
+
+// Checks API keys from the key file and bearer tokens against the JWKS file.
+// Authentication is off when neither is configured.
+func getAuthenticator(env environment) (*middleware.Authenticator, error) {
+	if env.API_KEYS_FILE == "" && env.JWT_JWKS_FILE == "" {
+		zap.L().Warn("No API key or JWKS file, every request is allowed")
+		return nil, nil
+	}
 
-			return fields
-		}),
-	}))
-	cur_router.Use(ginzap.RecoveryWithZap(logger, true))
+	auth, err := middleware.NewAuthenticator(nil)
+	if env.API_KEYS_FILE != "" {
+		auth, err = middleware.LoadAPIKeys(env.API_KEYS_FILE)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if env.JWT_JWKS_FILE != "" {
+		auth.Tokens, err = middleware.OpenTokenVerifier(middleware.TokenConfig{
+			JWKSFile:       env.JWT_JWKS_FILE,
+			ReloadInterval: env.JWT_RELOAD_INTERVAL,
+			Issuer:         env.JWT_ISSUER,
+			Audience:       env.JWT_AUDIENCE,
+			Leeway:         env.JWT_LEEWAY,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return auth, nil
+}
 
-	cur_router.Use(middleware.RateLimiter)
+func getRateLimits(env environment) (middleware.RateLimitConfig, error) {
+	if env.RATE_LIMIT_FILE == "" {
+		return middleware.DefaultRateLimits(), nil
+	}
+	return middleware.LoadRateLimits(env.RATE_LIMIT_FILE)
+}
+
+func getServer(cfg router.Config) *http.Server {
+	env := getEnv()
+
+	cur_router := router.SetUpRouter(cfg)
 
 	server := &http.Server{
 		Addr:    env.HOSTNAME + ":" + env.PORT,
@@ -81,13 +174,93 @@ func main() {
 	undo := zap.ReplaceGlobals(logger)
 	defer undo()
 
-	// Load specs in globally accessible variable
-	if err := spec.PrintSpec("api.yml"); err != nil {
-		logger.Sugar().Fatalf("Error loading spec: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			logger.Sugar().Fatalf("Error importing receipts: %v", err)
+		}
 		return
 	}
 
-	server := getServer()
+	// Deferred cleanup in serve has run by the time it returns, so exiting
+	// here never skips closing the store
+	if err := serve(logger); err != nil {
+		logger.Sugar().Fatal(err)
+	}
+}
+
+func serve(logger *zap.Logger) error {
+	// Requests are validated against the spec
+	apiSpec, err := spec.Load("api.yml")
+	if err != nil {
+		return fmt.Errorf("error loading spec: %w", err)
+	}
+	info := apiSpec.Document.Model.Info
+	logger.Info(fmt.Sprintf("Serving %s %s", info.Title, info.Version))
+
+	env := getEnv()
+	receipts, err := getStore(env)
+	if err != nil {
+		return fmt.Errorf("error opening store: %w", err)
+	}
+	defer func() {
+		if closer, ok := receipts.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				logger.Sugar().Errorf("Error closing store: %v", err)
+			}
+		}
+	}()
+
+	rules, err := models.LoadRuleRegistry(env.RULES_DIR, env.RULES_VERSION)
+	if err != nil {
+		return fmt.Errorf("error loading rules: %w", err)
+	}
+
+	logger.Info(fmt.Sprintf("Scoring receipts with rule version %d", rules.Current().Version))
+
+	backfilled, err := store.BackfillPoints(context.Background(), receipts, rules.Current())
+	if err != nil {
+		return fmt.Errorf("error scoring unversioned receipts: %w", err)
+	}
+	if backfilled > 0 {
+		logger.Info(fmt.Sprintf("Scored %d receipts stored before rule sets were versioned", backfilled))
+	}
+
+	consistency := getConsistencyPolicy(env)
+	if err := consistency.Validate(); err != nil {
+		return fmt.Errorf("error in consistency policy: %w", err)
+	}
+
+	duplicates := getDuplicatePolicy(env)
+	if err := duplicates.Validate(); err != nil {
+		return fmt.Errorf("error in duplicate policy: %w", err)
+	}
+
+	auth, err := getAuthenticator(env)
+	if err != nil {
+		return fmt.Errorf("error loading credentials: %w", err)
+	}
+	if auth != nil && auth.Tokens != nil {
+		defer auth.Tokens.Close()
+	}
+
+	rateLimits, err := getRateLimits(env)
+	if err != nil {
+		return fmt.Errorf("error loading rate limits: %w", err)
+	}
+
+	server := getServer(router.Config{
+		Receipts:          receipts,
+		Rules:             rules,
+		Consistency:       consistency,
+		Duplicates:        duplicates,
+		IdempotencyWindow: env.IDEMPOTENCY_WINDOW,
+		Auth:              auth,
+		RateLimits:        &rateLimits,
+		Spec:              apiSpec,
+		ServerURL:         "http://" + env.HOSTNAME + ":" + env.PORT,
+		ValidateResponses: gin.IsDebugging(),
+		TrustedProxies:    env.TRUSTED_PROXIES,
+	})
 
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
@@ -105,12 +278,12 @@ func main() {
 	logger.Sugar().Info(fmt.Sprintf("Listening on %s", server.Addr))
 
 	if err := server.ListenAndServe(); err != nil {
-		if err == http.ErrServerClosed {
-			logger.Info("Server closed under request")
-		} else {
-			logger.Sugar().Errorf("Server closed unexpectedly: %v", err)
+		if err != http.ErrServerClosed {
+			return fmt.Errorf("server closed unexpectedly: %w", err)
 		}
+		logger.Info("Server closed under request")
 	}
 
 	logger.Info("Server exiting")
+	return nil
 }
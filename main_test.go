@@ -1,8 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/jiyo4476/receipt-processor-challenge/csvimport"
+
+	"github.com/jiyo4476/receipt-processor-challenge/middleware"
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/jiyo4476/receipt-processor-challenge/router"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -17,9 +28,107 @@ func TestGetEnv(t *testing.T) {
 	test_env := getEnv()
 	assert.Equal(t, test_env.HOSTNAME, "localhost", "hostname should be localhost")
 	assert.Equal(t, test_env.PORT, "8080", "port should be 8080")
+	assert.Equal(t, test_env.RULES_DIR, "rules", "rules directory should default to rules")
+	assert.Equal(t, test_env.RULES_VERSION, 0, "rule version should default to the latest")
 }
 
 func TestGetServer(t *testing.T) {
-	test_server := getServer()
+	test_server := getServer(router.Config{Receipts: store.NewMemoryStore()})
 	assert.NotNil(t, test_server, "Server should not be nil")
 }
+
+func TestGetStoreMemory(t *testing.T) {
+	test_store, err := getStore(environment{})
+	assert.NoError(t, err, "Error creating store")
+	assert.IsType(t, &store.MemoryStore{}, test_store, "Store should be in memory")
+}
+
+func TestGetStoreFile(t *testing.T) {
+	test_store, err := getStore(environment{DATA_DIR: t.TempDir()})
+	assert.NoError(t, err, "Error creating store")
+	assert.IsType(t, &store.FileStore{}, test_store, "Store should be file backed")
+	assert.NoError(t, test_store.(*store.FileStore).Close())
+}
+
+func TestGetStoreExplicitFile(t *testing.T) {
+	_, err := getStore(environment{STORE: "file"})
+	assert.Error(t, err, "File store without a data directory should fail")
+}
+
+func TestGetStoreUnknown(t *testing.T) {
+	_, err := getStore(environment{STORE: "redis"})
+	assert.Error(t, err, "Unknown store should fail")
+}
+
+func TestGetEnvStore(t *testing.T) {
+	t.Setenv("RECEIPT_PROCESSOR_STORE", "sql")
+	t.Setenv("RECEIPT_PROCESSOR_SQL_DSN", "test.db")
+	test_env := getEnv()
+	assert.Equal(t, "sql", test_env.STORE, "store should be sql")
+	assert.Equal(t, "sqlite", test_env.SQL_DRIVER, "driver should default to sqlite")
+	assert.Equal(t, "test.db", test_env.SQL_DSN, "dsn should be test.db")
+}
+
+func TestGetDuplicatePolicy(t *testing.T) {
+	assert.Equal(t, models.DefaultDuplicatePolicy, getDuplicatePolicy(getEnv()))
+	t.Setenv("RECEIPT_PROCESSOR_DUPLICATE_POLICY", "reject")
+	assert.Equal(t, models.DuplicateReject, getDuplicatePolicy(getEnv()))
+}
+
+func TestGetConsistencyPolicy(t *testing.T) {
+	t.Setenv("RECEIPT_PROCESSOR_CONSISTENCY_TAX_RATE", "0.0825")
+	t.Setenv("RECEIPT_PROCESSOR_CONSISTENCY_ROUNDING", "0.05")
+	policy := getConsistencyPolicy(getEnv())
+	assert.Equal(t, models.DefaultConsistencyMode, policy.Mode, "consistency mode should default to the models default")
+	assert.Equal(t, models.Multiplier(825), policy.TaxRate, "tax rate should be 8.25%")
+	assert.Equal(t, models.MustParseMoney("0.05"), policy.Rounding, "rounding should be 0.05")
+	assert.NoError(t, policy.Validate())
+}
+
+func TestRunImport(t *testing.T) {
+	t.Setenv("RECEIPT_PROCESSOR_STORE", "memory")
+	csv := "id,retailer,purchase_date,purchase_time,total,short_description,price\n" +
+		"1,Target,2022-01-01,13:01,6.49,Mountain Dew 12PK,6.49\n"
+	var out bytes.Buffer
+	err := runImport([]string{"-key", "id", "-"}, strings.NewReader(csv), &out)
+	assert.NoError(t, err, "Error importing receipts")
+
+	var report csvimport.Report
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, 1, report.Imported)
+
+	assert.Error(t, runImport([]string{}, strings.NewReader(csv), &out), "A file is required")
+	assert.Error(t, runImport([]string{"missing.csv"}, strings.NewReader(csv), &out), "Missing files should fail")
+}
+
+func TestGetRateLimits(t *testing.T) {
+	limits, err := getRateLimits(environment{})
+	assert.NoError(t, err)
+	assert.Equal(t, middleware.DefaultRateLimits(), limits, "Limits should default to one request per second")
+
+	_, err = getRateLimits(environment{RATE_LIMIT_FILE: "missing.yml"})
+	assert.Error(t, err, "Missing files should fail")
+}
+
+func TestGetAuthenticator(t *testing.T) {
+	auth, err := getAuthenticator(environment{})
+	assert.NoError(t, err)
+	assert.Nil(t, auth, "Authentication should be off without a key file")
+
+	_, err = getAuthenticator(environment{API_KEYS_FILE: "missing.yml"})
+	assert.Error(t, err, "Missing files should fail")
+
+	_, err = getAuthenticator(environment{JWT_JWKS_FILE: "missing.json", JWT_ISSUER: "gateway", JWT_AUDIENCE: "receipts"})
+	assert.Error(t, err, "Missing JWKS files should fail")
+
+	jwks := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(jwks, []byte(`{"keys": [{"kty": "oct", "kid": "hs", "k": "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY"}]}`), 0o600))
+	_, err = getAuthenticator(environment{JWT_JWKS_FILE: jwks})
+	assert.Error(t, err, "Tokens without an issuer and audience should fail")
+
+	auth, err = getAuthenticator(environment{JWT_JWKS_FILE: jwks, JWT_ISSUER: "gateway", JWT_AUDIENCE: "receipts"})
+	assert.NoError(t, err)
+	if assert.NotNil(t, auth) && assert.NotNil(t, auth.Tokens) {
+		auth.Tokens.Close()
+	}
+}
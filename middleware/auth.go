@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ScopeRead  = "receipts:read"
+	ScopeWrite = "receipts:write"
+	// Grants every other scope
+	ScopeAdmin = "admin"
+
+	// Keys are sent as "Authorization: ApiKey <key>"
+	apiKeyScheme = "ApiKey"
+	// Tokens are sent as "Authorization: Bearer <token>"
+	bearerScheme = "Bearer"
+	principalKey = "principal"
+)
+
+var keyHashFormat = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// APIKey is one entry of the key file. Only the hex SHA-256 of the key is
+// stored, so the file does not hold the keys themselves.
+type APIKey struct {
+	Name   string   `yaml:"name"`
+	Hash   string   `yaml:"hash"`
+	Scopes []string `yaml:"scopes"`
+}
+
+func (k APIKey) Validate() error {
+	if k.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !keyHashFormat.MatchString(k.Hash) {
+		return fmt.Errorf("hash must be a lowercase hex SHA-256")
+	}
+	if len(k.Scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range k.Scopes {
+		switch scope {
+		case ScopeRead, ScopeWrite, ScopeAdmin:
+		default:
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// Principal is the client a request was authenticated as
+type Principal struct {
+	// The key's name, or the subject of a token
+	Name string
+	// The issuer of a token, empty for API keys
+	Issuer string
+	Scopes []string
+}
+
+func (p Principal) HasScope(scope string) bool {
+	for _, granted := range p.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Qualified name of the principal, "token:<issuer> <subject>" for tokens and
+// "key:<name>" for API keys, so a key and a token subject with the same name
+// are never confused
+func (p Principal) Identity() string {
+	if p.Issuer != "" {
+		return "token:" + p.Issuer + " " + p.Name
+	}
+	return "key:" + p.Name
+}
+
+// Names the client sending the request, its principal's identity or
+// "ip:<address>" for anonymous requests
+func ClientIdentity(c *gin.Context) string {
+	if principal, ok := GetPrincipal(c); ok {
+		return principal.Identity()
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// The client the request was authenticated as, ok is false for anonymous
+// requests
+func GetPrincipal(c *gin.Context) (principal Principal, ok bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return Principal{}, false
+	}
+	principal, ok = value.(Principal)
+	return principal, ok
+}
+
+// Authenticator checks the API key of every request against the key file,
+// and bearer tokens when Tokens is set
+type Authenticator struct {
+	keys   map[string]APIKey
+	Tokens *TokenVerifier
+}
+
+func NewAuthenticator(keys []APIKey) (*Authenticator, error) {
+	a := &Authenticator{keys: map[string]APIKey{}}
+	names := map[string]bool{}
+	for i, key := range keys {
+		if err := key.Validate(); err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("key %q is defined more than once", key.Name)
+		}
+		if _, ok := a.keys[key.Hash]; ok {
+			return nil, fmt.Errorf("key %q has the same hash as another key", key.Name)
+		}
+		names[key.Name] = true
+		a.keys[key.Hash] = key
+	}
+	return a, nil
+}
+
+func LoadAPIKeys(path string) (*Authenticator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading key file: %w", err)
+	}
+	auth, err := ParseAPIKeys(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return auth, nil
+}
+
+// Decodes and validates a YAML key file, unknown fields are rejected
+func ParseAPIKeys(data []byte) (*Authenticator, error) {
+	var file struct {
+		Keys []APIKey `yaml:"keys"`
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, err
+	}
+	return NewAuthenticator(file.Keys)
+}
+
+// The hex SHA-256 of a key as it is written in the key file
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+// Middleware that identifies the client from the Authorization header.
+// Requests without the header continue anonymously and are turned away by
+// RequireScope, requests with an unknown key or a bad token are rejected with
+// 401.
+func (a *Authenticator) Handle(c *gin.Context) {
+	header := c.GetHeader("Authorization")
+	if header == "" {
+		c.Next()
+		return
+	}
+	scheme, credentials, _ := strings.Cut(header, " ")
+	switch {
+	case credentials == "":
+	case strings.EqualFold(scheme, apiKeyScheme):
+		entry, ok := a.keys[HashAPIKey(credentials)]
+		if !ok {
+			zap.L().Warn("Request with an unknown API key")
+			a.unauthorized(c, "API key is not valid")
+			return
+		}
+		c.Set(principalKey, Principal{Name: entry.Name, Scopes: entry.Scopes})
+		c.Next()
+		return
+	case strings.EqualFold(scheme, bearerScheme) && a.Tokens != nil:
+		principal, err := a.Tokens.Verify(credentials)
+		if err != nil {
+			zap.L().Warn(fmt.Sprintf("Request with an invalid token: %v", err))
+			a.unauthorized(c, "token is not valid")
+			return
+		}
+		c.Set(principalKey, principal)
+		c.Next()
+		return
+	}
+	if a.Tokens != nil {
+		a.unauthorized(c, "Authorization header must be of the form \"ApiKey <key>\" or \"Bearer <token>\"")
+		return
+	}
+	a.unauthorized(c, "Authorization header must be of the form \"ApiKey <key>\"")
+}
+
+// Middleware that lets the request through only when the client has the
+// scope. A nil Authenticator means authentication is off and allows every
+// request.
+func (a *Authenticator) RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if a == nil {
+			c.Next()
+			return
+		}
+		principal, ok := GetPrincipal(c)
+		if !ok {
+			a.unauthorized(c, "an API key or token is required")
+			return
+		}
+		if !principal.HasScope(scope) {
+			zap.L().Warn(fmt.Sprintf("Client %s lacks scope %s", principal.Name, scope))
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Forbidden",
+				"message": fmt.Sprintf("credentials lack the %s scope", scope),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func (a *Authenticator) unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", apiKeyScheme+` realm="receipts"`)
+	if a.Tokens != nil {
+		c.Writer.Header().Add("WWW-Authenticate", bearerScheme+` realm="receipts"`)
+	}
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"error":   "Unauthorized",
+		"message": message,
+	})
+}
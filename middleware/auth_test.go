@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func createAuthTestRouter(t *testing.T) *gin.Engine {
+	auth, err := ParseAPIKeys([]byte(fmt.Sprintf(`
+keys:
+    - name: reporting
+      hash: %s
+      scopes: [receipts:read]
+    - name: operations
+      hash: %s
+      scopes: [admin]
+`, HashAPIKey("read-key"), HashAPIKey("admin-key"))))
+	assert.NoError(t, err, "Error parsing key file")
+
+	router := gin.New()
+	router.Use(auth.Handle)
+	ok := func(c *gin.Context) {
+		principal, _ := GetPrincipal(c)
+		c.String(http.StatusOK, principal.Name)
+	}
+	router.GET("/receipts", auth.RequireScope(ScopeRead), ok)
+	router.POST("/receipts/process", auth.RequireScope(ScopeWrite), ok)
+	return router
+}
+
+func sendWithAuthorization(router http.Handler, method string, path string, authorization string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthenticator_Scopes(t *testing.T) {
+	router := createAuthTestRouter(t)
+
+	w := sendWithAuthorization(router, "GET", "/receipts", "ApiKey read-key")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "reporting", w.Body.String(), "The key's name should be available to handlers")
+
+	w = sendWithAuthorization(router, "POST", "/receipts/process", "ApiKey read-key")
+	assert.Equal(t, http.StatusForbidden, w.Code, "Keys without the scope should be forbidden")
+
+	w = sendWithAuthorization(router, "POST", "/receipts/process", "apikey admin-key")
+	assert.Equal(t, http.StatusOK, w.Code, "Admin keys should have every scope")
+}
+
+func TestAuthenticator_Unauthorized(t *testing.T) {
+	router := createAuthTestRouter(t)
+
+	for _, authorization := range []string{"", "ApiKey wrong-key", "Bearer read-key", "ApiKey", "read-key"} {
+		w := sendWithAuthorization(router, "GET", "/receipts", authorization)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "Expected 401 for %q", authorization)
+		assert.Equal(t, `ApiKey realm="receipts"`, w.Header().Get("WWW-Authenticate"))
+	}
+}
+
+func TestAuthenticator_Off(t *testing.T) {
+	var auth *Authenticator
+	router := gin.New()
+	router.GET("/receipts", auth.RequireScope(ScopeAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+	assert.Equal(t, http.StatusOK, sendWithAuthorization(router, "GET", "/receipts", "").Code)
+}
+
+func TestParseAPIKeys_Invalid(t *testing.T) {
+	hash := HashAPIKey("key")
+	invalid := []string{
+		fmt.Sprintf("keys: [{hash: %s, scopes: [admin]}]", hash),
+		"keys: [{name: a, hash: abc, scopes: [admin]}]",
+		fmt.Sprintf("keys: [{name: a, hash: %s, scopes: []}]", hash),
+		fmt.Sprintf("keys: [{name: a, hash: %s, scopes: [receipts:delete]}]", hash),
+		fmt.Sprintf("keys: [{name: a, hash: %s, scopes: [admin]}, {name: a, hash: %s, scopes: [admin]}]", hash, HashAPIKey("other")),
+		fmt.Sprintf("keys: [{name: a, hash: %s, scopes: [admin]}, {name: b, hash: %s, scopes: [admin]}]", hash, hash),
+		fmt.Sprintf("keys: [{name: a, hash: %s, scopes: [admin], key: secret}]", hash),
+	}
+	for _, data := range invalid {
+		_, err := ParseAPIKeys([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestPrincipal_Identity(t *testing.T) {
+	assert.Equal(t, "key:alice", Principal{Name: "alice"}.Identity())
+	assert.Equal(t, "token:https://issuer.example alice", Principal{Name: "alice", Issuer: "https://issuer.example"}.Identity())
+}
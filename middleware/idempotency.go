@@ -0,0 +1,215 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// Set on responses replayed for a repeated key
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	idempotencySweepInterval = time.Minute
+	// Bodies are read whole to be hashed, so requests with a key are limited
+	maxIdempotentBody = 10 << 20
+	// The most responses remembered at once, the entry closest to expiring
+	// is dropped to make room
+	maxIdempotentResponses = 10000
+)
+
+// The first response for a key, replayed to retries of the same request
+type idempotent_response struct {
+	bodyHash    [32]byte
+	done        bool
+	status      int
+	contentType string
+	body        []byte
+	expires     time.Time
+}
+
+// Idempotency remembers the response to each request sent with an
+// Idempotency-Key header, so a client can safely retry a request whose
+// response it never received. Keys belong to the client that sent them and
+// responses are kept in memory for the window given to NewIdempotency.
+type Idempotency struct {
+	window    time.Duration
+	limit     int
+	mu        sync.Mutex
+	responses map[string]*idempotent_response
+	nextSweep time.Time
+}
+
+func NewIdempotency(window time.Duration) *Idempotency {
+	return &Idempotency{window: window, limit: maxIdempotentResponses, responses: map[string]*idempotent_response{}}
+}
+
+// Middleware that replays the stored response when a key is reused with the
+// same body and rejects it with 422 when the body differs
+func (i *Idempotency) Handle(c *gin.Context) {
+	key := c.GetHeader(IdempotencyKeyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error":   "Invalid Idempotency-Key",
+			"message": "Idempotency-Key must be at most 255 characters",
+		})
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBody))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":   "Request too large",
+			"message": fmt.Sprintf("bodies sent with an Idempotency-Key must be at most %d bytes", tooLarge.Limit),
+		})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Failed to read request", "message": err.Error()})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	hash := sha256.Sum256(body)
+	// Keys are scoped to the client and the route they were sent to, so one
+	// client can neither replay nor block another's responses
+	scoped := ClientIdentity(c) + " " + c.Request.Method + " " + c.FullPath() + " " + key
+
+	now := time.Now()
+	i.mu.Lock()
+	i.sweep(now)
+	stored, ok := i.responses[scoped]
+	if ok && now.After(stored.expires) {
+		ok = false
+	}
+	if !ok {
+		i.makeRoom(now)
+		stored = &idempotent_response{bodyHash: hash, expires: now.Add(i.window)}
+		i.responses[scoped] = stored
+	}
+	i.mu.Unlock()
+
+	if ok {
+		i.replay(c, stored, hash)
+		return
+	}
+
+	writer := &capture_writer{ResponseWriter: c.Writer}
+	c.Writer = writer
+	completed := false
+	defer func() {
+		// A handler that panicked left no response to replay, so the key is
+		// released for the retry while the panic goes on to Recovery
+		if !completed {
+			i.forget(scoped, stored)
+		}
+	}()
+	c.Next()
+	completed = true
+
+	if writer.Status() >= http.StatusInternalServerError {
+		// Failures are not remembered so the retry can succeed
+		i.forget(scoped, stored)
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	stored.done = true
+	stored.status = writer.Status()
+	stored.contentType = writer.Header().Get("Content-Type")
+	stored.body = writer.body.Bytes()
+}
+
+// Drops the entry for a key unless it was already replaced by a later request
+func (i *Idempotency) forget(scoped string, stored *idempotent_response) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.responses[scoped] == stored {
+		delete(i.responses, scoped)
+	}
+}
+
+func (i *Idempotency) replay(c *gin.Context, stored *idempotent_response, hash [32]byte) {
+	i.mu.Lock()
+	done, status, contentType, body := stored.done, stored.status, stored.contentType, stored.body
+	i.mu.Unlock()
+
+	switch {
+	case stored.bodyHash != hash:
+		zap.L().Warn("Idempotency-Key reused with a different body")
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Idempotency-Key reused",
+			"message": "Idempotency-Key was already used with a different request body",
+		})
+	case !done:
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error":   "Request in progress",
+			"message": "a request with this Idempotency-Key is still being processed",
+		})
+	default:
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(status, contentType, body)
+		c.Abort()
+	}
+}
+
+// Drops expired entries, at most once a minute, including requests that never
+// finished. Called with mu held.
+func (i *Idempotency) sweep(now time.Time) {
+	if now.Before(i.nextSweep) {
+		return
+	}
+	for key, stored := range i.responses {
+		if now.After(stored.expires) {
+			delete(i.responses, key)
+		}
+	}
+	i.nextSweep = now.Add(idempotencySweepInterval)
+}
+
+// Drops expired entries early and then the entry closest to expiring when
+// the limit is reached. Called with mu held.
+func (i *Idempotency) makeRoom(now time.Time) {
+	if len(i.responses) < i.limit {
+		return
+	}
+	i.nextSweep = time.Time{}
+	i.sweep(now)
+	for len(i.responses) >= i.limit {
+		oldest := ""
+		for key, stored := range i.responses {
+			if oldest == "" || stored.expires.Before(i.responses[oldest].expires) {
+				oldest = key
+			}
+		}
+		delete(i.responses, oldest)
+	}
+}
+
+// Copies the response body while it is written
+type capture_writer struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capture_writer) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capture_writer) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,206 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func createIdempotencyTestRouter(window time.Duration, status *int) (*gin.Engine, *int) {
+	calls := 0
+	router := gin.New()
+	router.POST("/receipts/process", NewIdempotency(window).Handle, func(c *gin.Context) {
+		calls++
+		c.JSON(*status, gin.H{"call": calls})
+	})
+	return router, &calls
+}
+
+func sendWithKey(router http.Handler, key string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotency_Replay(t *testing.T) {
+	status := http.StatusOK
+	router, calls := createIdempotencyTestRouter(time.Hour, &status)
+
+	first := sendWithKey(router, "abc", `{"retailer":"Target"}`)
+	retry := sendWithKey(router, "abc", `{"retailer":"Target"}`)
+	assert.Equal(t, 1, *calls, "Retries should not reach the handler")
+	assert.Equal(t, first.Code, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", retry.Header().Get("Content-Type"))
+	assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+	assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+
+	sendWithKey(router, "other", `{"retailer":"Target"}`)
+	sendWithKey(router, "", `{"retailer":"Target"}`)
+	sendWithKey(router, "", `{"retailer":"Target"}`)
+	assert.Equal(t, 4, *calls, "Other keys and requests without a key should be handled")
+}
+
+func TestIdempotency_DifferentBody(t *testing.T) {
+	status := http.StatusOK
+	router, calls := createIdempotencyTestRouter(time.Hour, &status)
+
+	sendWithKey(router, "abc", `{"retailer":"Target"}`)
+	w := sendWithKey(router, "abc", `{"retailer":"Walgreens"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code, "Expected status code 422")
+	assert.Equal(t, 1, *calls)
+}
+
+func TestIdempotency_Window(t *testing.T) {
+	status := http.StatusOK
+	router, calls := createIdempotencyTestRouter(time.Millisecond, &status)
+
+	sendWithKey(router, "abc", `{}`)
+	time.Sleep(5 * time.Millisecond)
+	w := sendWithKey(router, "abc", `{}`)
+	assert.Equal(t, 2, *calls, "Keys should be forgotten after the window")
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+}
+
+func TestIdempotency_ServerErrorsNotStored(t *testing.T) {
+	status := http.StatusInternalServerError
+	router, calls := createIdempotencyTestRouter(time.Hour, &status)
+
+	sendWithKey(router, "abc", `{}`)
+	status = http.StatusOK
+	w := sendWithKey(router, "abc", `{}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, *calls, "Failed requests should be retried")
+
+	// Client errors are replayed like successes
+	status = http.StatusBadRequest
+	sendWithKey(router, "def", `{}`)
+	status = http.StatusOK
+	w = sendWithKey(router, "def", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 3, *calls)
+}
+
+func TestIdempotency_InProgress(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	router := gin.New()
+	router.POST("/receipts/process", NewIdempotency(time.Hour).Handle, func(c *gin.Context) {
+		close(started)
+		<-release
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		sendWithKey(router, "abc", `{}`)
+	}()
+	<-started
+	w := sendWithKey(router, "abc", `{}`)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, http.StatusConflict, w.Code, "Expected status code 409 while the first request runs")
+}
+
+func TestIdempotency_PanicReleasesKey(t *testing.T) {
+	calls := 0
+	router := gin.New()
+	router.Use(gin.CustomRecovery(func(c *gin.Context, err any) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.POST("/receipts/process", NewIdempotency(time.Hour).Handle, func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("handler failed")
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	w := sendWithKey(router, "abc", `{}`)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	w = sendWithKey(router, "abc", `{}`)
+	assert.Equal(t, http.StatusOK, w.Code, "The retry should not wait on the request that panicked")
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotency_SweepDropsUnfinished(t *testing.T) {
+	i := NewIdempotency(time.Hour)
+	now := time.Now()
+	i.responses["stuck"] = &idempotent_response{expires: now.Add(-time.Second)}
+	i.responses["running"] = &idempotent_response{expires: now.Add(time.Hour)}
+	i.sweep(now)
+	assert.NotContains(t, i.responses, "stuck", "Expired entries should be dropped even if never finished")
+	assert.Contains(t, i.responses, "running")
+}
+
+func TestIdempotency_ScopedToClient(t *testing.T) {
+	calls := 0
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if name := c.GetHeader("X-Test-Client"); name != "" {
+			c.Set(principalKey, Principal{Name: name})
+		}
+	})
+	router.POST("/receipts/process", NewIdempotency(time.Hour).Handle, func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusOK, gin.H{"call": calls})
+	})
+	send := func(client string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "abc")
+		req.Header.Set("X-Test-Client", client)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	send("alice")
+	w := send("bob")
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader), "Another client's response should not be replayed")
+	w = send("alice")
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotency_KeyTooLong(t *testing.T) {
+	status := http.StatusOK
+	router, calls := createIdempotencyTestRouter(time.Hour, &status)
+	w := sendWithKey(router, strings.Repeat("a", 256), `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Expected status code 400")
+	assert.Equal(t, 0, *calls)
+}
+
+func TestIdempotency_BodyTooLarge(t *testing.T) {
+	status := http.StatusOK
+	router, calls := createIdempotencyTestRouter(time.Hour, &status)
+	w := sendWithKey(router, "abc", strings.Repeat("a", maxIdempotentBody+1))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "Expected status code 413")
+	assert.Equal(t, 0, *calls)
+}
+
+func TestIdempotency_Limit(t *testing.T) {
+	i := NewIdempotency(time.Hour)
+	i.limit = 2
+	router := gin.New()
+	router.POST("/receipts/process", i.Handle, func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	for _, key := range []string{"a", "b", "c"} {
+		sendWithKey(router, key, `{}`)
+		time.Sleep(time.Millisecond)
+	}
+	assert.Len(t, i.responses, 2)
+	assert.Empty(t, sendWithKey(router, "a", `{}`).Header().Get(IdempotentReplayedHeader), "The oldest response should be dropped")
+	assert.Equal(t, "true", sendWithKey(router, "a", `{}`).Header().Get(IdempotentReplayedHeader))
+}
@@ -0,0 +1,283 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// The signing algorithms tokens may use, each matches one kind of key
+var tokenMethods = []string{"HS256", "RS256", "ES256"}
+
+// TokenConfig says where the signing keys are and which tokens are accepted
+type TokenConfig struct {
+	// JSON Web Key Set file holding the keys tokens are signed with
+	JWKSFile string
+	// How often the key file is read again, zero never reloads it
+	ReloadInterval time.Duration
+	// The iss and aud claims every token must carry
+	Issuer   string
+	Audience string
+	// Clock skew allowed when checking exp and nbf
+	Leeway time.Duration
+}
+
+func (c TokenConfig) Validate() error {
+	if c.JWKSFile == "" {
+		return fmt.Errorf("a JWKS file is required")
+	}
+	if c.Issuer == "" || c.Audience == "" {
+		return fmt.Errorf("issuer and audience are required")
+	}
+	if c.ReloadInterval < 0 || c.Leeway < 0 {
+		return fmt.Errorf("reload interval and leeway must not be negative")
+	}
+	return nil
+}
+
+// A key from the key set, paired with the algorithm it verifies
+type verification_key struct {
+	alg string
+	key interface{}
+}
+
+// TokenVerifier checks bearer tokens against the keys in a JWKS file, which is
+// read again every reload interval so keys can be rotated without a restart
+type TokenVerifier struct {
+	config TokenConfig
+	parser *jwt.Parser
+
+	mu   sync.RWMutex
+	keys map[string]verification_key
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func OpenTokenVerifier(config TokenConfig) (*TokenVerifier, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	v := &TokenVerifier{
+		config: config,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(tokenMethods),
+			jwt.WithIssuer(config.Issuer),
+			jwt.WithAudience(config.Audience),
+			jwt.WithExpirationRequired(),
+			jwt.WithLeeway(config.Leeway),
+		),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := v.Reload(); err != nil {
+		return nil, err
+	}
+	if config.ReloadInterval > 0 {
+		go v.reloadLoop(config.ReloadInterval)
+	} else {
+		close(v.done)
+	}
+	return v, nil
+}
+
+// Reads the key file again. The keys in use are kept when it is not valid.
+func (v *TokenVerifier) Reload() error {
+	data, err := os.ReadFile(v.config.JWKSFile)
+	if err != nil {
+		return fmt.Errorf("error reading JWKS file: %w", err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return fmt.Errorf("invalid JWKS file %s: %w", v.config.JWKSFile, err)
+	}
+	v.mu.Lock()
+	v.keys = keys
+	v.mu.Unlock()
+	return nil
+}
+
+func (v *TokenVerifier) reloadLoop(interval time.Duration) {
+	defer close(v.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := v.Reload(); err != nil {
+				zap.L().Error(fmt.Sprintf("Error reloading signing keys: %v", err))
+			}
+		case <-v.stop:
+			return
+		}
+	}
+}
+
+// Stops reloading the key file
+func (v *TokenVerifier) Close() error {
+	v.closeOnce.Do(func() {
+		close(v.stop)
+		<-v.done
+	})
+	return nil
+}
+
+type token_claims struct {
+	// Space separated scopes, as in OAuth 2.0
+	Scope string `json:"scope"`
+	jwt.RegisteredClaims
+}
+
+// Checks the token's signature and claims and returns who it was issued to
+func (v *TokenVerifier) Verify(token string) (Principal, error) {
+	var claims token_claims
+	if _, err := v.parser.ParseWithClaims(token, &claims, v.key); err != nil {
+		return Principal{}, err
+	}
+	if claims.Subject == "" {
+		return Principal{}, fmt.Errorf("token has no subject")
+	}
+	principal := Principal{Name: claims.Subject, Issuer: claims.Issuer}
+	for _, scope := range strings.Fields(claims.Scope) {
+		switch scope {
+		case ScopeRead, ScopeWrite, ScopeAdmin:
+			principal.Scopes = append(principal.Scopes, scope)
+		}
+	}
+	return principal, nil
+}
+
+// Picks the key named by the token's kid, which may be left out when the set
+// holds a single key
+func (v *TokenVerifier) key(token *jwt.Token) (interface{}, error) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := v.keys[kid]
+	if !ok && kid == "" && len(v.keys) == 1 {
+		for _, only := range v.keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	// Stops a token signed with HS256 using a public key as the secret
+	if key.alg != token.Method.Alg() {
+		return nil, fmt.Errorf("key %q does not verify %s tokens", kid, token.Method.Alg())
+	}
+	return key.key, nil
+}
+
+// One key of a JSON Web Key Set, RFC 7517
+type json_web_key struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// Symmetric keys
+	K string `json:"k"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// Elliptic curve keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// Decodes the signing keys of a JSON Web Key Set by kid. Keys meant for
+// encryption or of types that are not supported are skipped.
+func ParseJWKS(data []byte) (map[string]verification_key, error) {
+	var set struct {
+		Keys []json_web_key `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+	keys := map[string]verification_key{}
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.verificationKey()
+		if errors.Is(err, errUnsupportedKey) {
+			zap.L().Warn(fmt.Sprintf("Skipping signing key %q: %v", jwk.Kid, err))
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		if _, ok := keys[jwk.Kid]; ok {
+			return nil, fmt.Errorf("key %q is defined more than once", jwk.Kid)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys")
+	}
+	return keys, nil
+}
+
+var errUnsupportedKey = errors.New("unsupported key")
+
+func (k json_web_key) verificationKey() (verification_key, error) {
+	var key verification_key
+	switch k.Kty {
+	case "oct":
+		secret, err := decodeSegment(k.K)
+		if err != nil || len(secret) < 32 {
+			return key, fmt.Errorf("k must be a base64url secret of at least 32 bytes")
+		}
+		key = verification_key{alg: "HS256", key: secret}
+	case "RSA":
+		n, err := decodeSegment(k.N)
+		if err != nil || len(n) < 256 {
+			return key, fmt.Errorf("n must be a base64url modulus of at least 2048 bits")
+		}
+		e, err := decodeSegment(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return key, fmt.Errorf("e must be a base64url exponent")
+		}
+		exponent := new(big.Int).SetBytes(e)
+		key = verification_key{alg: "RS256", key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}
+	case "EC":
+		if k.Crv != "P-256" {
+			return key, fmt.Errorf("%w: curve %q", errUnsupportedKey, k.Crv)
+		}
+		x, errX := decodeSegment(k.X)
+		y, errY := decodeSegment(k.Y)
+		if errX != nil || errY != nil {
+			return key, fmt.Errorf("x and y must be base64url coordinates")
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !public.Curve.IsOnCurve(public.X, public.Y) {
+			return key, fmt.Errorf("point is not on the P-256 curve")
+		}
+		key = verification_key{alg: "ES256", key: public}
+	default:
+		return key, fmt.Errorf("%w: key type %q", errUnsupportedKey, k.Kty)
+	}
+	if k.Alg != "" && k.Alg != key.alg {
+		return key, fmt.Errorf("%w: algorithm %q", errUnsupportedKey, k.Alg)
+	}
+	return key, nil
+}
+
+func decodeSegment(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+}
@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+type test_signing_keys struct {
+	secret []byte
+	rsa    *rsa.PrivateKey
+	ec     *ecdsa.PrivateKey
+}
+
+func createTestSigningKeys(t *testing.T) test_signing_keys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	return test_signing_keys{secret: []byte("0123456789abcdef0123456789abcdef"), rsa: rsaKey, ec: ecKey}
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (k test_signing_keys) jwks() []byte {
+	data, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "oct", "kid": "hs", "k": encodeSegment(k.secret)},
+		{"kty": "RSA", "kid": "rs", "use": "sig", "alg": "RS256",
+			"n": encodeSegment(k.rsa.N.Bytes()), "e": encodeSegment(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "es", "crv": "P-256",
+			"x": encodeSegment(k.ec.X.FillBytes(make([]byte, 32))), "y": encodeSegment(k.ec.Y.FillBytes(make([]byte, 32)))},
+		// Keys for encryption are skipped
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+	return data
+}
+
+func writeJWKS(t *testing.T, path string, data []byte) {
+	assert.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func openTestTokenVerifier(t *testing.T, keys test_signing_keys) (*TokenVerifier, string) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, keys.jwks())
+	verifier, err := OpenTokenVerifier(TokenConfig{JWKSFile: path, Issuer: "gateway", Audience: "receipts"})
+	assert.NoError(t, err, "Error opening token verifier")
+	t.Cleanup(func() { verifier.Close() })
+	return verifier, path
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":   "user-42",
+		"iss":   "gateway",
+		"aud":   "receipts",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "receipts:read receipts:write profile",
+	}
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	assert.NoError(t, err, "Error signing token")
+	return signed
+}
+
+func TestTokenVerifier_Algorithms(t *testing.T) {
+	keys := createTestSigningKeys(t)
+	verifier, _ := openTestTokenVerifier(t, keys)
+
+	tokens := map[string]string{
+		"HS256": signToken(t, jwt.SigningMethodHS256, "hs", keys.secret, validClaims()),
+		"RS256": signToken(t, jwt.SigningMethodRS256, "rs", keys.rsa, validClaims()),
+		"ES256": signToken(t, jwt.SigningMethodES256, "es", keys.ec, validClaims()),
+	}
+	for alg, token := range tokens {
+		principal, err := verifier.Verify(token)
+		assert.NoError(t, err, alg)
+		assert.Equal(t, "user-42", principal.Name, alg)
+		assert.Equal(t, "gateway", principal.Issuer, alg)
+		assert.Equal(t, []string{ScopeRead, ScopeWrite}, principal.Scopes, "Unknown scopes should be dropped")
+	}
+}
+
+func TestTokenVerifier_Rejects(t *testing.T) {
+	keys := createTestSigningKeys(t)
+	verifier, _ := openTestTokenVerifier(t, keys)
+
+	with := func(name string, value interface{}) jwt.MapClaims {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	tokens := map[string]string{
+		"expired":         signToken(t, jwt.SigningMethodES256, "es", keys.ec, with("exp", time.Now().Add(-time.Hour).Unix())),
+		"not yet valid":   signToken(t, jwt.SigningMethodES256, "es", keys.ec, with("nbf", time.Now().Add(time.Hour).Unix())),
+		"no expiry":       signToken(t, jwt.SigningMethodES256, "es", keys.ec, with("exp", nil)),
+		"wrong issuer":    signToken(t, jwt.SigningMethodES256, "es", keys.ec, with("iss", "someone-else")),
+		"wrong audience":  signToken(t, jwt.SigningMethodES256, "es", keys.ec, with("aud", "billing")),
+		"no subject":      signToken(t, jwt.SigningMethodES256, "es", keys.ec, with("sub", nil)),
+		"unknown kid":     signToken(t, jwt.SigningMethodES256, "other", keys.ec, validClaims()),
+		"wrong key":       signToken(t, jwt.SigningMethodHS256, "hs", []byte("a different secret of 32 bytes!!"), validClaims()),
+		"algorithm mixup": signToken(t, jwt.SigningMethodHS256, "rs", keys.secret, validClaims()),
+		"unsigned":        signToken(t, jwt.SigningMethodNone, "hs", jwt.UnsafeAllowNoneSignatureType, validClaims()),
+		"malformed":       "not.a.token",
+	}
+	for name, token := range tokens {
+		_, err := verifier.Verify(token)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestTokenVerifier_Reload(t *testing.T) {
+	keys := createTestSigningKeys(t)
+	verifier, path := openTestTokenVerifier(t, keys)
+	rotated := createTestSigningKeys(t)
+	rotated.secret = []byte("fedcba9876543210fedcba9876543210")
+
+	writeJWKS(t, path, []byte(`{"keys": [}`))
+	assert.Error(t, verifier.Reload(), "Invalid files should not be loaded")
+	_, err := verifier.Verify(signToken(t, jwt.SigningMethodES256, "es", keys.ec, validClaims()))
+	assert.NoError(t, err, "The keys in use should be kept")
+
+	writeJWKS(t, path, rotated.jwks())
+	assert.NoError(t, verifier.Reload())
+	_, err = verifier.Verify(signToken(t, jwt.SigningMethodES256, "es", keys.ec, validClaims()))
+	assert.Error(t, err, "Rotated out keys should not verify")
+	_, err = verifier.Verify(signToken(t, jwt.SigningMethodHS256, "hs", rotated.secret, validClaims()))
+	assert.NoError(t, err, "New keys should verify")
+}
+
+func TestTokenVerifier_ReloadsPeriodically(t *testing.T) {
+	keys := createTestSigningKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, keys.jwks())
+	verifier, err := OpenTokenVerifier(TokenConfig{
+		JWKSFile: path, Issuer: "gateway", Audience: "receipts", ReloadInterval: 10 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer verifier.Close()
+
+	rotated := createTestSigningKeys(t)
+	writeJWKS(t, path, rotated.jwks())
+	token := signToken(t, jwt.SigningMethodES256, "es", rotated.ec, validClaims())
+	assert.Eventually(t, func() bool {
+		_, err := verifier.Verify(token)
+		return err == nil
+	}, time.Second, 10*time.Millisecond, "The key file should be reloaded")
+}
+
+func TestParseJWKS_Invalid(t *testing.T) {
+	invalid := []string{
+		`{"keys": []}`,
+		`{"keys": [{"kty": "oct", "kid": "short", "k": "c2hvcnQ"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "rs", "n": "AQAB", "e": "AQAB"}]}`,
+		`{"keys": [{"kty": "EC", "kid": "es", "crv": "P-256", "x": "AQAB", "y": "AQAB"}]}`,
+		`{"keys": [{"kty": "OKP", "kid": "ed"}]}`,
+	}
+	for _, data := range invalid {
+		_, err := ParseJWKS([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestAuthenticator_BearerTokens(t *testing.T) {
+	keys := createTestSigningKeys(t)
+	verifier, _ := openTestTokenVerifier(t, keys)
+	auth, err := NewAuthenticator([]APIKey{{Name: "reporting", Hash: HashAPIKey("read-key"), Scopes: []string{ScopeRead}}})
+	assert.NoError(t, err)
+	auth.Tokens = verifier
+
+	router := gin.New()
+	router.Use(auth.Handle)
+	router.POST("/receipts/process", auth.RequireScope(ScopeWrite), func(c *gin.Context) {
+		principal, _ := GetPrincipal(c)
+		c.String(http.StatusOK, principal.Name)
+	})
+
+	token := signToken(t, jwt.SigningMethodRS256, "rs", keys.rsa, validClaims())
+	w := sendWithAuthorization(router, "POST", "/receipts/process", "Bearer "+token)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user-42", w.Body.String(), "The subject should be available to handlers")
+
+	w = sendWithAuthorization(router, "POST", "/receipts/process", "Bearer "+token+"x")
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "Tampered tokens should be rejected")
+	assert.Equal(t, []string{`ApiKey realm="receipts"`, `Bearer realm="receipts"`}, w.Header().Values("WWW-Authenticate"))
+
+	w = sendWithAuthorization(router, "POST", "/receipts/process", "ApiKey read-key")
+	assert.Equal(t, http.StatusForbidden, w.Code, "API keys should still work")
+}
@@ -1,22 +1,259 @@
 package middleware
 
 import (
+	"bytes"
+	"fmt"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
 )
 
-var limiter = rate.NewLimiter(1, 5)
+const (
+	defaultIdleTimeout       = 10 * time.Minute
+	defaultPerIPRate         = 10
+	defaultPerIPBurst        = 50
+	rateLimitSweepInterval   = time.Minute
+	rateLimitLimitHeader     = "RateLimit-Limit"
+	rateLimitRemainingHeader = "RateLimit-Remaining"
+	rateLimitResetHeader     = "RateLimit-Reset"
+)
+
+// RateLimit is a token bucket, Rate requests per second are allowed with
+// bursts of up to Burst requests
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+func (l RateLimit) Validate() error {
+	if l.Rate <= 0 || math.IsInf(l.Rate, 0) || math.IsNaN(l.Rate) {
+		return fmt.Errorf("rate must be a positive number")
+	}
+	if l.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1")
+	}
+	return nil
+}
+
+// The limits of a tier of clients. Routes are keyed by method and path
+// pattern, for example "POST /receipts/batch", and have a bucket of their own.
+// Every other route shares the Default bucket.
+type RateLimits struct {
+	Default RateLimit            `yaml:"default"`
+	Routes  map[string]RateLimit `yaml:"routes"`
+}
+
+func (l RateLimits) Validate() error {
+	if err := l.Default.Validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for route, limit := range l.Routes {
+		if err := limit.Validate(); err != nil {
+			return fmt.Errorf("route %q: %w", route, err)
+		}
+	}
+	return nil
+}
+
+// RateLimitConfig holds the limits of clients without a tier, the limits of
+// each tier and the tier of each API key
+type RateLimitConfig struct {
+	RateLimits `yaml:",inline"`
+	// A tier's limits replace the top level ones for its clients
+	Tiers map[string]RateLimits `yaml:"tiers"`
+	// The tier of each API key, keyed by the name in the key file
+	Clients map[string]string `yaml:"clients"`
+	// Limit of every IP address across all routes, checked before
+	// authentication so requests with invalid credentials are limited too.
+	// Zero is 10 requests per second with bursts of 50.
+	PerIP RateLimit `yaml:"perIP"`
+	// How long a bucket is kept after the client's last request, zero is 10m
+	IdleTimeout time.Duration `yaml:"idleTimeout"`
+}
+
+func (c RateLimitConfig) Validate() error {
+	if err := c.RateLimits.Validate(); err != nil {
+		return err
+	}
+	for name, tier := range c.Tiers {
+		if err := tier.Validate(); err != nil {
+			return fmt.Errorf("tier %q: %w", name, err)
+		}
+	}
+	for client, tier := range c.Clients {
+		if _, ok := c.Tiers[tier]; !ok {
+			return fmt.Errorf("client %s has unknown tier %q", client, tier)
+		}
+	}
+	if c.PerIP != (RateLimit{}) {
+		if err := c.PerIP.Validate(); err != nil {
+			return fmt.Errorf("perIP: %w", err)
+		}
+	}
+	if c.IdleTimeout < 0 {
+		return fmt.Errorf("idleTimeout must not be negative")
+	}
+	return nil
+}
+
+// The limit of a route for a tier and the name of the bucket it is counted in
+func (c RateLimitConfig) limit(tier string, route string) (RateLimit, string) {
+	limits, ok := c.Tiers[tier]
+	if !ok {
+		limits = c.RateLimits
+	}
+	if limit, ok := limits.Routes[route]; ok {
+		return limit, route
+	}
+	return limits.Default, ""
+}
+
+// One request per second with bursts of five for every client
+func DefaultRateLimits() RateLimitConfig {
+	return RateLimitConfig{RateLimits: RateLimits{Default: RateLimit{Rate: 1, Burst: 5}}}
+}
+
+func LoadRateLimits(path string) (RateLimitConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RateLimitConfig{}, fmt.Errorf("error reading rate limit file: %w", err)
+	}
+	config, err := ParseRateLimits(data)
+	if err != nil {
+		return RateLimitConfig{}, fmt.Errorf("invalid rate limit file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// Decodes and validates YAML rate limits, unknown fields are rejected
+func ParseRateLimits(data []byte) (RateLimitConfig, error) {
+	var config RateLimitConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil {
+		return RateLimitConfig{}, err
+	}
+	if err := config.Validate(); err != nil {
+		return RateLimitConfig{}, err
+	}
+	return config, nil
+}
+
+type client_bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// RateLimiter gives every client a token bucket per limited route, so one busy
+// client does not use up the requests of the others. Buckets are kept in
+// memory and dropped once the client has been idle for the idle timeout.
+// HandleIP runs before the Authenticator and Handle after it, to tell API keys
+// apart.
+type RateLimiter struct {
+	config    RateLimitConfig
+	mu        sync.Mutex
+	buckets   map[string]*client_bucket
+	nextSweep time.Time
+}
+
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = defaultIdleTimeout
+	}
+	if config.PerIP == (RateLimit{}) {
+		config.PerIP = RateLimit{Rate: defaultPerIPRate, Burst: defaultPerIPBurst}
+	}
+	return &RateLimiter{config: config, buckets: map[string]*client_bucket{}}
+}
+
+// Middleware that rejects requests over the client's limit with 429. Every
+// response carries the RateLimit headers of the bucket the request used.
+func (l *RateLimiter) Handle(c *gin.Context) {
+	client, tier := l.client(c)
+	limit, route := l.config.limit(tier, c.Request.Method+" "+c.FullPath())
+	if l.allow(c, client+" "+route, limit, client) {
+		c.Next()
+	}
+}
 
-// Middleware to check the rate limit.
-func RateLimiter(c *gin.Context) {
-	if !limiter.Allow() {
-		zap.L().Warn("To many requests")
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many requests please try again later"})
-		c.Abort()
+// Middleware that rejects requests over the PerIP limit of their address with
+// 429. It runs before authentication, so clients guessing credentials are
+// limited as well.
+func (l *RateLimiter) HandleIP(c *gin.Context) {
+	client := "ip:" + c.ClientIP()
+	if l.allow(c, "before-auth "+client, l.config.PerIP, client) {
+		c.Next()
+	}
+}
+
+// Takes a token from the bucket under key and sets the RateLimit headers.
+// Requests over the limit are answered with 429 and allow returns false.
+func (l *RateLimiter) allow(c *gin.Context, key string, limit RateLimit, client string) bool {
+	now := time.Now()
+	l.mu.Lock()
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &client_bucket{limiter: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)}
+		l.buckets[key] = bucket
+	}
+	bucket.lastSeen = now
+	allowed := bucket.limiter.AllowN(now, 1)
+	tokens := bucket.limiter.TokensAt(now)
+	l.mu.Unlock()
+
+	c.Header(rateLimitLimitHeader, strconv.Itoa(limit.Burst))
+	c.Header(rateLimitRemainingHeader, strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+	c.Header(rateLimitResetHeader, strconv.Itoa(secondsUntil(float64(limit.Burst)-tokens, limit.Rate)))
+	if !allowed {
+		retry := secondsUntil(1-tokens, limit.Rate)
+		zap.L().Warn(fmt.Sprintf("Too many requests from %s", client))
+		c.Header("Retry-After", strconv.Itoa(retry))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":   "Too many requests",
+			"message": fmt.Sprintf("rate limit exceeded, retry in %d seconds", retry),
+		})
+		return false
+	}
+	return true
+}
+
+// Names the client sending the request and its tier. Authenticated clients
+// are limited by API key or token subject, anonymous ones by IP.
+func (l *RateLimiter) client(c *gin.Context) (client string, tier string) {
+	principal, ok := GetPrincipal(c)
+	// Token holders are not assigned tiers
+	if ok && principal.Issuer == "" {
+		tier = l.config.Clients[principal.Name]
+	}
+	return ClientIdentity(c), tier
+}
+
+// Whole seconds, rounded up, until the bucket has gained tokens
+func secondsUntil(tokens float64, perSecond float64) int {
+	if tokens <= 0 {
+		return 0
+	}
+	return int(math.Ceil(tokens / perSecond))
+}
+
+// Drops idle buckets, at most once a minute. Called with mu held.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Before(l.nextSweep) {
 		return
 	}
-	c.Next()
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > l.config.IdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.nextSweep = now.Add(rateLimitSweepInterval)
 }
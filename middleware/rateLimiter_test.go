@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRateLimits = `
+default:
+    rate: 1
+    burst: 2
+routes:
+    "POST /receipts/batch":
+        rate: 0.5
+        burst: 1
+tiers:
+    partner:
+        default:
+            rate: 10
+            burst: 4
+clients:
+    partner: partner
+idleTimeout: 5m
+`
+
+func createRateLimitTestRouter(t *testing.T) (*gin.Engine, *RateLimiter) {
+	config, err := ParseRateLimits([]byte(testRateLimits))
+	assert.NoError(t, err, "Error parsing rate limits")
+	auth, err := NewAuthenticator([]APIKey{
+		{Name: "partner", Hash: HashAPIKey("partner-key"), Scopes: []string{ScopeRead}},
+		{Name: "other", Hash: HashAPIKey("other-key"), Scopes: []string{ScopeRead}},
+	})
+	assert.NoError(t, err, "Error creating authenticator")
+	limiter := NewRateLimiter(config)
+	router := gin.New()
+	router.Use(auth.Handle, limiter.Handle)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/receipts", ok)
+	router.POST("/receipts/batch", ok)
+	return router, limiter
+}
+
+func sendFrom(router http.Handler, method string, path string, ip string, key string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = ip + ":1234"
+	if key != "" {
+		req.Header.Set("Authorization", "ApiKey "+key)
+	}
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimiter_PerClient(t *testing.T) {
+	router, _ := createRateLimitTestRouter(t)
+
+	first := sendFrom(router, "GET", "/receipts", "192.0.2.1", "")
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "2", first.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", first.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "1", first.Header().Get("RateLimit-Reset"))
+
+	assert.Equal(t, http.StatusOK, sendFrom(router, "GET", "/receipts", "192.0.2.1", "").Code)
+	limited := sendFrom(router, "GET", "/receipts", "192.0.2.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code, "The third request should be limited")
+	assert.Equal(t, "1", limited.Header().Get("Retry-After"))
+	assert.Equal(t, "0", limited.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusOK, sendFrom(router, "GET", "/receipts", "192.0.2.2", "").Code,
+		"Other clients should not be limited")
+	assert.Equal(t, http.StatusOK, sendFrom(router, "GET", "/receipts", "192.0.2.1", "other-key").Code,
+		"Clients with an API key should be limited by key")
+}
+
+func TestRateLimiter_Routes(t *testing.T) {
+	router, _ := createRateLimitTestRouter(t)
+
+	assert.Equal(t, http.StatusOK, sendFrom(router, "POST", "/receipts/batch", "192.0.2.1", "").Code)
+	limited := sendFrom(router, "POST", "/receipts/batch", "192.0.2.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code, "The route limit should apply")
+	assert.Equal(t, "2", limited.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, sendFrom(router, "GET", "/receipts", "192.0.2.1", "").Code,
+		"Other routes should have their own bucket")
+}
+
+func TestRateLimiter_Tiers(t *testing.T) {
+	router, _ := createRateLimitTestRouter(t)
+
+	for i := 0; i < 4; i++ {
+		w := sendFrom(router, "POST", "/receipts/batch", "192.0.2.1", "partner-key")
+		assert.Equal(t, http.StatusOK, w.Code, "Partners should get the tier limit")
+		assert.Equal(t, "4", w.Header().Get("RateLimit-Limit"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, sendFrom(router, "GET", "/receipts", "192.0.2.1", "partner-key").Code,
+		"Routes without a tier limit should share the tier default")
+}
+
+func TestRateLimiter_EvictsIdleClients(t *testing.T) {
+	router, limiter := createRateLimitTestRouter(t)
+	sendFrom(router, "GET", "/receipts", "192.0.2.1", "")
+	sendFrom(router, "GET", "/receipts", "192.0.2.2", "")
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	assert.Len(t, limiter.buckets, 2)
+	now := time.Now()
+	limiter.buckets["ip:192.0.2.1 "].lastSeen = now
+	limiter.buckets["ip:192.0.2.2 "].lastSeen = now.Add(-time.Minute)
+	limiter.sweep(now.Add(5 * time.Minute))
+	assert.Len(t, limiter.buckets, 1, "Only the idle bucket should be dropped")
+	assert.Contains(t, limiter.buckets, "ip:192.0.2.1 ")
+}
+
+func TestRateLimiter_PerIPBeforeAuth(t *testing.T) {
+	auth, err := NewAuthenticator([]APIKey{{Name: "other", Hash: HashAPIKey("other-key"), Scopes: []string{ScopeRead}}})
+	assert.NoError(t, err, "Error creating authenticator")
+	limiter := NewRateLimiter(RateLimitConfig{
+		RateLimits: RateLimits{Default: RateLimit{Rate: 1, Burst: 5}},
+		PerIP:      RateLimit{Rate: 1, Burst: 2},
+	})
+	router := gin.New()
+	router.Use(limiter.HandleIP, auth.Handle, limiter.Handle)
+	router.GET("/receipts", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	assert.Equal(t, http.StatusUnauthorized, sendFrom(router, "GET", "/receipts", "192.0.2.1", "guess-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, sendFrom(router, "GET", "/receipts", "192.0.2.1", "guess-2").Code)
+	assert.Equal(t, http.StatusTooManyRequests, sendFrom(router, "GET", "/receipts", "192.0.2.1", "other-key").Code,
+		"Invalid keys should use up the address's limit")
+	assert.Equal(t, http.StatusOK, sendFrom(router, "GET", "/receipts", "192.0.2.2", "other-key").Code)
+}
+
+func TestParseRateLimits_Invalid(t *testing.T) {
+	invalid := []string{
+		"default: {rate: 0, burst: 1}",
+		"default: {rate: 1, burst: 0}",
+		"default: {rate: 1, burst: 1}\nclients: {abc: gold}",
+		"default: {rate: 1, burst: 1}\nroutes: {\"GET /receipts\": {rate: -1, burst: 1}}",
+		"default: {rate: 1, burst: 1}\nunknown: true",
+		"default: {rate: 1, burst: 1}\nperIP: {rate: 1, burst: 0}",
+	}
+	for _, data := range invalid {
+		_, err := ParseRateLimits([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
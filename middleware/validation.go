@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiyo4476/receipt-processor-challenge/spec"
+	"go.uber.org/zap"
+)
+
+// Middleware that rejects requests whose path, query, headers or body do not
+// match the operation the OpenAPI document gives for the route. Every
+// violation is listed in the response.
+func ValidateRequests(document *spec.Spec) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			// Unknown routes are answered by the router
+			c.Next()
+			return
+		}
+		if err := document.ValidateRequest(c.Request, openAPIPath(route)); err != nil {
+			zap.L().Warn(fmt.Sprintf("Invalid request to %s %s: %v", c.Request.Method, route, err))
+			c.AbortWithStatusJSON(err.Status, gin.H{
+				"error":      "Invalid request",
+				"message":    err.Error(),
+				"violations": err.Violations,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// Bodies longer than this are not kept, so only their status and headers are
+// checked
+const maxValidatedResponse = 1 << 20
+
+// Middleware that checks every response against those the OpenAPI document
+// declares for the route and calls report with the ways it does not match.
+// The response is sent unchanged, so this is meant for development.
+func ValidateResponses(document *spec.Spec, report func(c *gin.Context, err *spec.ValidationError)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			c.Next()
+			return
+		}
+		writer := &recording_writer{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		body := writer.body.Bytes()
+		if writer.truncated {
+			body = nil
+		}
+		err := document.ValidateResponse(c.Request, openAPIPath(route), writer.Status(), writer.Header(), body)
+		if err != nil && !(writer.truncated && onlyBody(err)) {
+			report(c, err)
+		}
+	}
+}
+
+// Reports response violations in the log
+func LogResponseViolations(c *gin.Context, err *spec.ValidationError) {
+	zap.L().Warn(fmt.Sprintf("Response %d to %s %s does not match the spec: %v",
+		c.Writer.Status(), c.Request.Method, c.FullPath(), err))
+}
+
+func onlyBody(err *spec.ValidationError) bool {
+	for _, violation := range err.Violations {
+		if violation.In != "body" {
+			return false
+		}
+	}
+	return true
+}
+
+// Keeps a copy of the body written through it, up to maxValidatedResponse
+type recording_writer struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	truncated bool
+}
+
+// Lets http.ResponseController reach the connection, so handlers can still
+// flush and enable full duplex
+func (w *recording_writer) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *recording_writer) Write(data []byte) (int, error) {
+	w.record(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recording_writer) WriteString(data string) (int, error) {
+	w.record([]byte(data))
+	return w.ResponseWriter.WriteString(data)
+}
+
+func (w *recording_writer) record(data []byte) {
+	if w.truncated {
+		return
+	}
+	if w.body.Len()+len(data) > maxValidatedResponse {
+		w.truncated = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
+
+// Converts a gin route such as /receipts/:id to the document's /receipts/{id}
+func openAPIPath(route string) string {
+	segments := strings.Split(route, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jiyo4476/receipt-processor-challenge/spec"
+	"github.com/stretchr/testify/assert"
+)
+
+const validationTestSpec = `
+openapi: 3.0.3
+info:
+    title: Test
+    version: 1.0.0
+paths:
+    /things/{id}:
+        put:
+            parameters:
+                - name: id
+                  in: path
+                  required: true
+                  schema:
+                      type: integer
+            requestBody:
+                required: true
+                content:
+                    application/json:
+                        schema:
+                            type: object
+                            required: [name]
+                            properties:
+                                name:
+                                    type: string
+            responses:
+                200:
+                    description: OK
+`
+
+func createValidationTestRouter(t *testing.T) *gin.Engine {
+	document, err := spec.Parse([]byte(validationTestSpec))
+	assert.NoError(t, err, "Error parsing spec")
+	router := gin.New()
+	router.Use(ValidateRequests(document))
+	router.PUT("/things/:id", func(c *gin.Context) {
+		var body map[string]string
+		if err := c.BindJSON(&body); err != nil {
+			return
+		}
+		c.String(http.StatusOK, body["name"])
+	})
+	return router
+}
+
+func sendJSON(router http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestValidateRequests(t *testing.T) {
+	router := createValidationTestRouter(t)
+
+	w := sendJSON(router, "PUT", "/things/1", `{"name": "widget"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "widget", w.Body.String(), "The handler should get the body")
+
+	w = sendJSON(router, "PUT", "/things/one", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response struct {
+		Error      string
+		Message    string
+		Violations []spec.Violation
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Invalid request", response.Error)
+	assert.Equal(t, "Path parameter 'id' is not a valid number; body: missing property 'name'", response.Message)
+	assert.Equal(t, []spec.Violation{
+		{In: "path", Message: "Path parameter 'id' is not a valid number"},
+		{In: "body", Message: "missing property 'name'"},
+	}, response.Violations)
+
+	w = sendJSON(router, "GET", "/unknown", "")
+	assert.Equal(t, http.StatusNotFound, w.Code, "Unknown routes should be left to the router")
+}
+
+func TestValidateResponses(t *testing.T) {
+	document, err := spec.Parse([]byte(validationTestSpec))
+	assert.NoError(t, err, "Error parsing spec")
+	var reported []*spec.ValidationError
+	router := gin.New()
+	router.Use(ValidateResponses(document, func(c *gin.Context, err *spec.ValidationError) {
+		reported = append(reported, err)
+	}))
+	router.PUT("/things/:id", func(c *gin.Context) {
+		if c.Param("id") == "1" {
+			c.Status(http.StatusOK)
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"code": "error"})
+	})
+
+	w := sendJSON(router, "PUT", "/things/1", `{"name": "widget"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, reported, "Declared responses should not be reported")
+
+	w = sendJSON(router, "PUT", "/things/2", `{"name": "widget"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code, "The response should be sent unchanged")
+	assert.JSONEq(t, `{"code": "error"}`, w.Body.String())
+	if assert.Len(t, reported, 1) {
+		assert.Equal(t, "PUT operation request response code '404' does not exist", reported[0].Error())
+	}
+}
+
+func TestOpenAPIPath(t *testing.T) {
+	assert.Equal(t, "/receipts/{id}/points", openAPIPath("/receipts/:id/points"))
+	assert.Equal(t, "/files/{path}", openAPIPath("/files/*path"))
+	assert.Equal(t, "/receipts", openAPIPath("/receipts"))
+}
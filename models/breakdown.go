@@ -0,0 +1,24 @@
+package models
+
+// Points contributed by a single rule and why they were awarded
+type RuleResult struct {
+	Rule   string       `json:"rule"`
+	Reason string       `json:"reason"`
+	Points int64        `json:"points"`
+	Items  []ItemPoints `json:"items,omitempty"`
+}
+
+// Points contributed by one item under the description length rule
+type ItemPoints struct {
+	ShortDescription string `json:"shortDescription"`
+	Price            Money  `json:"price"`
+	TrimmedLength    int    `json:"trimmedLength"`
+	Points           int64  `json:"points"`
+	Reason           string `json:"reason"`
+}
+
+type PointsBreakdown struct {
+	Points      int64        `json:"points"`
+	RuleVersion int          `json:"ruleVersion"`
+	Rules       []RuleResult `json:"rules"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import "fmt"
+
+// How receipts whose total does not match their items are handled
+const (
+	// Totals are not compared with the items
+	ConsistencyOff = "off"
+	// Inconsistent receipts are accepted and flagged on the stored record
+	ConsistencyFlag = "flag"
+	// Inconsistent receipts are rejected
+	ConsistencyStrict = "strict"
+
+	// Used by the server and the router when no mode is configured
+	DefaultConsistencyMode = ConsistencyFlag
+)
+
+// ConsistencyPolicy decides how far a receipt's total may drift from the sum
+// of its item prices. The total may exceed the items by up to TaxRate of the
+// items plus Rounding, and fall short of them by up to MaxDiscount plus
+// Rounding.
+type ConsistencyPolicy struct {
+	Mode        string
+	TaxRate     Multiplier
+	MaxDiscount Money
+	Rounding    Money
+}
+
+// Outcome of comparing a receipt's total with its items
+type ConsistencyResult struct {
+	Consistent bool  `json:"consistent"`
+	ItemsTotal Money `json:"itemsTotal"`
+	Total      Money `json:"total"`
+	// Total minus the items total, positive when the total is higher
+	Difference Money `json:"difference"`
+	MinTotal   Money `json:"minTotal"`
+	MaxTotal   Money `json:"maxTotal"`
+}
+
+func (p ConsistencyPolicy) Validate() error {
+	switch p.Mode {
+	case ConsistencyOff, ConsistencyFlag, ConsistencyStrict:
+	default:
+		return fmt.Errorf("unknown consistency mode %q, expected off, flag or strict", p.Mode)
+	}
+	if p.TaxRate < 0 || p.MaxDiscount.Cents() < 0 || p.Rounding.Cents() < 0 {
+		return fmt.Errorf("consistency allowances must not be negative")
+	}
+	return nil
+}
+
+func (p ConsistencyPolicy) Check(r Receipt) ConsistencyResult {
+	itemsTotal := int64(0)
+	for _, item := range r.Items {
+		itemsTotal += item.Price.Cents()
+	}
+	tax := p.TaxRate.CeilCents(MoneyFromCents(itemsTotal))
+	total := r.Total.Cents()
+	minTotal := max(itemsTotal-p.MaxDiscount.Cents()-p.Rounding.Cents(), 0)
+	maxTotal := itemsTotal + tax + p.Rounding.Cents()
+
+	return ConsistencyResult{
+		Consistent: total >= minTotal && total <= maxTotal,
+		ItemsTotal: MoneyFromCents(itemsTotal),
+		Total:      r.Total,
+		Difference: MoneyFromCents(total - itemsTotal),
+		MinTotal:   MoneyFromCents(minTotal),
+		MaxTotal:   MoneyFromCents(maxTotal),
+	}
+}
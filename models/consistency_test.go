@@ -0,0 +1,62 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createConsistencyTestReceipt(total string, prices ...string) Receipt {
+	receipt := createRetailerTestReceipt("Target")
+	receipt.Items = []Item{}
+	for _, price := range prices {
+		receipt.Items = append(receipt.Items, Item{ShortDescription: "Item", Price: MustParseMoney(price)})
+	}
+	receipt.Total = MustParseMoney(total)
+	return receipt
+}
+
+func TestConsistencyCheck_Exact(t *testing.T) {
+	policy := ConsistencyPolicy{Mode: ConsistencyStrict}
+	result := policy.Check(createConsistencyTestReceipt("18.74", "6.49", "12.25"))
+	assert.True(t, result.Consistent)
+	assert.Equal(t, MustParseMoney("18.74"), result.ItemsTotal)
+	assert.Equal(t, MoneyFromCents(0), result.Difference)
+
+	result = policy.Check(createConsistencyTestReceipt("18.75", "6.49", "12.25"))
+	assert.False(t, result.Consistent)
+	assert.Equal(t, MoneyFromCents(1), result.Difference)
+}
+
+func TestConsistencyCheck_Allowances(t *testing.T) {
+	policy := ConsistencyPolicy{
+		Mode:        ConsistencyFlag,
+		TaxRate:     1000, // 10%
+		MaxDiscount: MustParseMoney("2.00"),
+		Rounding:    MustParseMoney("0.02"),
+	}
+	for total, consistent := range map[string]bool{
+		"10.00": true,
+		"11.02": true, // 10% tax and rounding
+		"11.03": false,
+		"7.98":  true, // discount and rounding
+		"7.97":  false,
+	} {
+		result := policy.Check(createConsistencyTestReceipt(total, "4.00", "6.00"))
+		assert.Equal(t, consistent, result.Consistent, "Unexpected result for total %s", total)
+	}
+}
+
+func TestConsistencyCheck_MinTotalNotNegative(t *testing.T) {
+	policy := ConsistencyPolicy{Mode: ConsistencyFlag, MaxDiscount: MustParseMoney("5.00")}
+	result := policy.Check(createConsistencyTestReceipt("0.00", "1.00"))
+	assert.True(t, result.Consistent)
+	assert.Equal(t, MoneyFromCents(0), result.MinTotal)
+}
+
+func TestConsistencyPolicy_Validate(t *testing.T) {
+	assert.NoError(t, ConsistencyPolicy{Mode: ConsistencyOff}.Validate())
+	assert.NoError(t, ConsistencyPolicy{Mode: ConsistencyStrict, Rounding: MoneyFromCents(1)}.Validate())
+	assert.Error(t, ConsistencyPolicy{Mode: "lenient"}.Validate())
+	assert.Error(t, ConsistencyPolicy{Mode: ConsistencyFlag, MaxDiscount: MoneyFromCents(-1)}.Validate())
+}
@@ -1,49 +1,32 @@
 package models
 
 import (
+	"fmt"
+	"reflect"
 	"regexp"
 
 	"github.com/go-playground/validator/v10"
 )
 
-var correctShortDescriptionFormat = regexp.MustCompile(`^[\w\s\-]+$`)
-var correctCashValueFormat = regexp.MustCompile(`^\d+\.\d{2}$`)
-var retailerNameFormat = regexp.MustCompile(`^[\w\s\-&]+$`)
-var correctDateFormat = regexp.MustCompile(`^(\d{4})-(1[0-2]|0[1-9])-(3[01]|[1-2]\d|0[1-9])$`)
-var correctTimeFormat = regexp.MustCompile(`(^24:00$)|(^([01][0-9]|[2][0-3])):[0-5][0-9]$`)
+//go:generate go run ../cmd/genmodels -spec ../api.yml -out spec_gen.go Receipt Item
 
-var CorrectShortDescription validator.Func = func(fl validator.FieldLevel) bool {
-	value, ok := fl.Field().Interface().(string)
-	if ok {
-		matched := correctShortDescriptionFormat.MatchString(value)
-		return matched
+// Validates strings against a pattern of the spec
+func matchesPattern(pattern *regexp.Regexp) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		value, ok := fl.Field().Interface().(string)
+		if ok {
+			return pattern.MatchString(value)
+		}
+		return false
 	}
-	return false
-}
-
-var CorrectCashValue validator.Func = func(fl validator.FieldLevel) bool {
-	value, ok := fl.Field().Interface().(string)
-	if ok {
-		matched := correctCashValueFormat.MatchString(value)
-		return matched
-	}
-	return false
-}
-
-var CorrectRetailerName validator.Func = func(fl validator.FieldLevel) bool {
-	value, ok := fl.Field().Interface().(string)
-	if ok {
-		matched := retailerNameFormat.MatchString(value)
-		return matched
-	}
-	return false
 }
 
+// Accepts only days that exist on the calendar
 var CorrectDate validator.Func = func(fl validator.FieldLevel) bool {
 	value, ok := fl.Field().Interface().(string)
 	if ok {
-		matched := correctDateFormat.MatchString(value)
-		return matched
+		_, err := ParseDate(value)
+		return err == nil
 	}
 	return false
 }
@@ -51,8 +34,18 @@ var CorrectDate validator.Func = func(fl validator.FieldLevel) bool {
 var CorrectTime validator.Func = func(fl validator.FieldLevel) bool {
 	value, ok := fl.Field().Interface().(string)
 	if ok {
-		matched := correctTimeFormat.MatchString(value)
-		return matched
+		_, err := ParseTimeOfDay(value)
+		return err == nil
 	}
 	return false
 }
+
+// Registers the custom validations and types used by the binding tags
+func RegisterValidators(v *validator.Validate) {
+	registerSpecValidators(v)
+	// Money, dates and times are validated in their wire format, unset values
+	// become empty strings and fail required
+	v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		return field.Interface().(fmt.Stringer).String()
+	}, Money{}, Date{}, TimeOfDay{})
+}
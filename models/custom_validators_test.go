@@ -193,6 +193,13 @@ func TestCorrectDateValid_CharRange(t *testing.T) {
 	tryValidateCorrectDate(t, "9999-12-32", false)
 }
 
+func TestCorrectDateInvalid_ImpossibleDay(t *testing.T) {
+	tryValidateCorrectDate(t, "2024-02-29", true)
+	tryValidateCorrectDate(t, "2023-02-29", false)
+	tryValidateCorrectDate(t, "2023-02-30", false)
+	tryValidateCorrectDate(t, "2023-04-31", false)
+}
+
 func TestCorrectDateInvalid_SectionLen(t *testing.T) {
 	tryValidateCorrectDate(t, "2024-01-01", true)
 	tryValidateCorrectDate(t, "20224-01-01", false)
@@ -234,7 +241,7 @@ func tryValidateCorrectTime(t *testing.T, input string, isValid bool) {
 
 func TestCorrectTime_CharRange(t *testing.T) {
 	tryValidateCorrectTime(t, "00:00", true)
-	tryValidateCorrectTime(t, "24:00", true)
+	tryValidateCorrectTime(t, "24:00", false)
 	tryValidateCorrectTime(t, "23:59", true)
 	tryValidateCorrectTime(t, "25:00", false)
 	tryValidateCorrectTime(t, "23:60", false)
@@ -0,0 +1,165 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+var correctDateFormat = regexp.MustCompile(`^(\d{4})-(1[0-2]|0[1-9])-(3[01]|[1-2]\d|0[1-9])$`)
+var correctTimeFormat = regexp.MustCompile(`^([01][0-9]|2[0-3]):[0-5][0-9]$`)
+
+// Date is a calendar day written as YYYY-MM-DD, such as "2022-01-01". Only
+// days that exist are accepted, so 2023-02-30 is rejected.
+type Date struct {
+	t     time.Time
+	valid bool
+}
+
+func ParseDate(value string) (Date, error) {
+	if !correctDateFormat.MatchString(value) {
+		return Date{}, fmt.Errorf("invalid date %q, expected a date such as 2022-01-01", value)
+	}
+	t, err := time.Parse(dateLayout, value)
+	if err != nil {
+		return Date{}, fmt.Errorf("invalid date %q, the day does not exist", value)
+	}
+	return Date{t: t, valid: true}, nil
+}
+
+// Like ParseDate but panics on invalid values, for constants and tests
+func MustParseDate(value string) Date {
+	d, err := ParseDate(value)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Reports whether the date was never set
+func (d Date) IsZero() bool {
+	return !d.valid
+}
+
+// Midnight UTC at the start of the day
+func (d Date) Time() time.Time {
+	return d.t
+}
+
+func (d Date) Day() int {
+	return d.t.Day()
+}
+
+// Unset dates are written as the empty string
+func (d Date) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.t.Format(dateLayout)
+}
+
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Date) UnmarshalText(text []byte) error {
+	parsed, err := ParseDate(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+func (d Date) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func (d *Date) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case string:
+		return d.UnmarshalText([]byte(value))
+	case []byte:
+		return d.UnmarshalText(value)
+	default:
+		return fmt.Errorf("cannot scan %T into Date", src)
+	}
+}
+
+// TimeOfDay is a 24 hour clock time written as HH:MM, such as "13:01", from
+// 00:00 to 23:59
+type TimeOfDay struct {
+	minutes int
+	valid   bool
+}
+
+func ParseTimeOfDay(value string) (TimeOfDay, error) {
+	if !correctTimeFormat.MatchString(value) {
+		return TimeOfDay{}, fmt.Errorf("invalid time %q, expected a time such as 13:01", value)
+	}
+	hours := int(value[0]-'0')*10 + int(value[1]-'0')
+	minutes := int(value[3]-'0')*10 + int(value[4]-'0')
+	return TimeOfDay{minutes: hours*60 + minutes, valid: true}, nil
+}
+
+// Like ParseTimeOfDay but panics on invalid values, for constants and tests
+func MustParseTimeOfDay(value string) TimeOfDay {
+	t, err := ParseTimeOfDay(value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Reports whether the time was never set
+func (t TimeOfDay) IsZero() bool {
+	return !t.valid
+}
+
+// Minutes since midnight
+func (t TimeOfDay) Minutes() int {
+	return t.minutes
+}
+
+func (t TimeOfDay) Before(other TimeOfDay) bool {
+	return t.minutes < other.minutes
+}
+
+// Unset times are written as the empty string
+func (t TimeOfDay) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%02d:%02d", t.minutes/60, t.minutes%60)
+}
+
+func (t TimeOfDay) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *TimeOfDay) UnmarshalText(text []byte) error {
+	parsed, err := ParseTimeOfDay(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+func (t TimeOfDay) Value() (driver.Value, error) {
+	return t.String(), nil
+}
+
+func (t *TimeOfDay) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case string:
+		return t.UnmarshalText([]byte(value))
+	case []byte:
+		return t.UnmarshalText(value)
+	default:
+		return fmt.Errorf("cannot scan %T into TimeOfDay", src)
+	}
+}
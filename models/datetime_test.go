@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDate(t *testing.T) {
+	for _, value := range []string{"2022-01-01", "2024-02-29", "2023-12-31", "0001-01-01"} {
+		date, err := ParseDate(value)
+		assert.NoError(t, err, "Error parsing %s", value)
+		assert.False(t, date.IsZero(), "%s should be set", value)
+		assert.Equal(t, value, date.String())
+	}
+	assert.True(t, Date{}.IsZero())
+	for _, value := range []string{"2023-02-29", "2023-02-30", "2023-04-31", "2022-13-01", "2022-1-01", ""} {
+		_, err := ParseDate(value)
+		assert.Error(t, err, "Expected an error for %q", value)
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	for value, minutes := range map[string]int{"00:00": 0, "13:01": 781, "23:59": 1439} {
+		parsed, err := ParseTimeOfDay(value)
+		assert.NoError(t, err, "Error parsing %s", value)
+		assert.False(t, parsed.IsZero(), "%s should be set", value)
+		assert.Equal(t, minutes, parsed.Minutes())
+		assert.Equal(t, value, parsed.String())
+	}
+	assert.True(t, TimeOfDay{}.IsZero())
+	for _, value := range []string{"24:00", "23:60", "9:00", "noon", ""} {
+		_, err := ParseTimeOfDay(value)
+		assert.Error(t, err, "Expected an error for %q", value)
+	}
+}
+
+func TestDateAndTime_JSON(t *testing.T) {
+	receipt := createRetailerTestReceipt("Target")
+	data, err := json.Marshal(receipt)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"purchaseDate":"2022-01-01"`)
+	assert.Contains(t, string(data), `"purchaseTime":"13:01"`)
+
+	var decoded Receipt
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, receipt.PurchaseDate, decoded.PurchaseDate)
+	assert.Equal(t, receipt.PurchaseTime, decoded.PurchaseTime)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"purchaseDate":"2023-02-30"}`), &decoded))
+	assert.Error(t, json.Unmarshal([]byte(`{"purchaseTime":"24:00"}`), &decoded))
+}
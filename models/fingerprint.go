@@ -0,0 +1,57 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// How receipts with the same fingerprint as a stored receipt are handled
+type DuplicatePolicy string
+
+const (
+	// Duplicates are rejected and the id of the stored receipt is returned
+	DuplicateReject DuplicatePolicy = "reject"
+	// Duplicates are accepted and marked with the id of the stored receipt
+	DuplicateFlag DuplicatePolicy = "flag"
+	// Duplicates are accepted like any other receipt
+	DuplicateAllow DuplicatePolicy = "allow"
+
+	// Used by the server and the router when no policy is configured
+	DefaultDuplicatePolicy = DuplicateFlag
+)
+
+func (p DuplicatePolicy) Validate() error {
+	switch p {
+	case DuplicateReject, DuplicateFlag, DuplicateAllow:
+		return nil
+	}
+	return fmt.Errorf("unknown duplicate policy %q, expected reject, flag or allow", string(p))
+}
+
+// Fingerprint identifies the purchase a receipt records. Receipts that differ
+// only in letter case, spacing or the order of their items share a fingerprint.
+func (r Receipt) Fingerprint() string {
+	items := make([]string, 0, len(r.Items))
+	for _, item := range r.Items {
+		items = append(items, fmt.Sprintf("%s=%d", normalizeText(item.ShortDescription), item.Price.Cents()))
+	}
+	sort.Strings(items)
+
+	canonical := strings.Join([]string{
+		normalizeText(r.Retailer),
+		r.PurchaseDate.String(),
+		r.PurchaseTime.String(),
+		fmt.Sprint(r.Total.Cents()),
+		strings.Join(items, "\n"),
+	}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
+
+// Lower case with runs of spaces collapsed and the ends trimmed
+func normalizeText(value string) string {
+	return strings.ToLower(strings.Join(strings.Fields(value), " "))
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFingerprint_Normalized(t *testing.T) {
+	receipt := createRetailerTestReceipt("Target")
+	same := createRetailerTestReceipt("  TARGET ")
+	same.Items = []Item{same.Items[1], same.Items[0]}
+	for i := range same.Items {
+		same.Items[i].ShortDescription = "  " + same.Items[i].ShortDescription + " "
+	}
+	assert.Equal(t, receipt.Fingerprint(), same.Fingerprint(), "Case, spacing and item order should not matter")
+	assert.Len(t, receipt.Fingerprint(), 64)
+}
+
+func TestFingerprint_Differs(t *testing.T) {
+	receipt := createRetailerTestReceipt("Target")
+	changes := map[string]func(r *Receipt){
+		"retailer": func(r *Receipt) { r.Retailer = "Walgreens" },
+		"date":     func(r *Receipt) { r.PurchaseDate = MustParseDate("2022-01-02") },
+		"time":     func(r *Receipt) { r.PurchaseTime = MustParseTimeOfDay("13:02") },
+		"total":    func(r *Receipt) { r.Total = MoneyFromCents(r.Total.Cents() + 1) },
+		"price":    func(r *Receipt) { r.Items[0].Price = MoneyFromCents(r.Items[0].Price.Cents() + 1) },
+		"item":     func(r *Receipt) { r.Items = r.Items[1:] },
+	}
+	for name, change := range changes {
+		changed := createRetailerTestReceipt("Target")
+		change(&changed)
+		assert.NotEqual(t, receipt.Fingerprint(), changed.Fingerprint(), "Changing the %s should change the fingerprint", name)
+	}
+}
+
+func TestDuplicatePolicy_Validate(t *testing.T) {
+	assert.NoError(t, DuplicateReject.Validate())
+	assert.NoError(t, DuplicateFlag.Validate())
+	assert.NoError(t, DuplicateAllow.Validate())
+	assert.Error(t, DuplicatePolicy("merge").Validate())
+}
@@ -0,0 +1,180 @@
+package models
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// Money is an exact amount in cents. It is written as a decimal string with
+// two fraction digits, such as "6.49", in JSON, YAML and the database. The
+// zero Money is unset rather than 0.00, so a missing amount fails required.
+type Money struct {
+	cents int64
+	set   bool
+}
+
+func ParseMoney(value string) (Money, error) {
+	if !correctCashValuePattern.MatchString(value) {
+		return Money{}, fmt.Errorf("invalid cash value %q, expected a value such as 6.49", value)
+	}
+	dollars, cents, _ := strings.Cut(value, ".")
+	whole, err := strconv.ParseInt(dollars, 10, 64)
+	if err != nil || whole > (1<<63-1)/100-1 {
+		return Money{}, fmt.Errorf("cash value %q is out of range", value)
+	}
+	fraction, _ := strconv.ParseInt(cents, 10, 64)
+	return MoneyFromCents(whole*100 + fraction), nil
+}
+
+// Like ParseMoney but panics on invalid values, for constants and tests
+func MustParseMoney(value string) Money {
+	m, err := ParseMoney(value)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func MoneyFromCents(cents int64) Money {
+	return Money{cents: cents, set: true}
+}
+
+// Reports whether the amount was never set
+func (m Money) IsZero() bool {
+	return !m.set
+}
+
+func (m Money) Cents() int64 {
+	return m.cents
+}
+
+// Unset amounts are written as the empty string
+func (m Money) String() string {
+	if m.IsZero() {
+		return ""
+	}
+	sign := ""
+	cents := m.cents
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+func (m Money) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalText(text []byte) error {
+	parsed, err := ParseMoney(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	if m.IsZero() {
+		return nil, nil
+	}
+	return m.String(), nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case string:
+		return m.UnmarshalText([]byte(value))
+	case []byte:
+		return m.UnmarshalText(value)
+	case int64:
+		*m = MoneyFromCents(value)
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+}
+
+// Multiplier is an exact decimal factor with up to four fraction digits, such
+// as 0.2, stored in ten-thousandths
+type Multiplier int64
+
+const multiplierScale = 10000
+
+func ParseMultiplier(value string) (Multiplier, error) {
+	whole, fraction, _ := strings.Cut(value, ".")
+	if whole == "" || len(fraction) > 4 || strings.ContainsAny(whole+fraction, "+-") {
+		return 0, fmt.Errorf("invalid multiplier %q, expected a value such as 0.2", value)
+	}
+	fraction += strings.Repeat("0", 4-len(fraction))
+	w, err := strconv.ParseInt(whole, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid multiplier %q, expected a value such as 0.2", value)
+	}
+	f, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid multiplier %q, expected a value such as 0.2", value)
+	}
+	return Multiplier(w*multiplierScale + f), nil
+}
+
+// Like ParseMultiplier but panics on invalid values, for constants and tests
+func MustParseMultiplier(value string) Multiplier {
+	m, err := ParseMultiplier(value)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func (m Multiplier) String() string {
+	s := fmt.Sprintf("%d.%04d", int64(m)/multiplierScale, int64(m)%multiplierScale)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func (m Multiplier) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Multiplier) UnmarshalText(text []byte) error {
+	parsed, err := ParseMultiplier(string(text))
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Multiplies the amount and rounds up to a whole number of dollars, using
+// integer arithmetic only. Amounts and multipliers are never negative.
+func (m Multiplier) CeilDollars(amount Money) int64 {
+	return m.ceil(amount, 100*multiplierScale)
+}
+
+// Multiplies the amount and rounds up to a whole number of cents
+func (m Multiplier) CeilCents(amount Money) int64 {
+	return m.ceil(amount, multiplierScale)
+}
+
+// Returns amount times the multiplier divided by divisor, rounded up. The
+// product is computed in 128 bits so large amounts cannot overflow, results
+// beyond int64 are capped and negative inputs give 0.
+func (m Multiplier) ceil(amount Money, divisor uint64) int64 {
+	if amount.Cents() <= 0 || m <= 0 {
+		return 0
+	}
+	hi, lo := bits.Mul64(uint64(amount.Cents()), uint64(m))
+	lo, carry := bits.Add64(lo, divisor-1, 0)
+	hi += carry
+	if hi >= divisor {
+		return math.MaxInt64
+	}
+	quotient, _ := bits.Div64(hi, lo, divisor)
+	return int64(min(quotient, math.MaxInt64))
+}
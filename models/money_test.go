@@ -0,0 +1,110 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseMoney_Valid(t *testing.T) {
+	for value, cents := range map[string]int64{"0.00": 0, "00.50": 50, "6.49": 649, "10.05": 1005, "999999.99": 99999999} {
+		m, err := ParseMoney(value)
+		assert.NoError(t, err, "Error parsing %s", value)
+		assert.Equal(t, cents, m.Cents(), "Unexpected cents for %s", value)
+	}
+}
+
+func TestParseMoney_Invalid(t *testing.T) {
+	for _, value := range []string{"", "abc", "6", "6.4", "6.499", "-6.49", "+6.49", "6.49.00", " 6.49", "99999999999999999999.00"} {
+		_, err := ParseMoney(value)
+		assert.Error(t, err, "Expected error parsing %q", value)
+	}
+}
+
+func TestMoney_String(t *testing.T) {
+	assert.Equal(t, "6.49", MoneyFromCents(649).String())
+	assert.Equal(t, "0.05", MoneyFromCents(5).String())
+	assert.Equal(t, "10.00", MoneyFromCents(1000).String())
+	assert.Equal(t, "-1.05", MoneyFromCents(-105).String())
+	assert.Equal(t, "1.00", MustParseMoney("01.00").String())
+}
+
+func TestMoney_JSON(t *testing.T) {
+	var item Item
+	err := json.Unmarshal([]byte(`{"shortDescription": "Dasani", "price": "1.40"}`), &item)
+	assert.NoError(t, err)
+	assert.Equal(t, MoneyFromCents(140), item.Price)
+
+	data, err := json.Marshal(item)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"shortDescription": "Dasani", "price": "1.40"}`, string(data))
+
+	assert.Error(t, json.Unmarshal([]byte(`{"price": 1.40}`), &item), "Numbers are not accepted")
+	assert.Error(t, json.Unmarshal([]byte(`{"price": "1.4"}`), &item), "One fraction digit is not accepted")
+}
+
+func TestMoney_Unset(t *testing.T) {
+	var item Item
+	assert.NoError(t, json.Unmarshal([]byte(`{"shortDescription": "Dasani"}`), &item))
+	assert.True(t, item.Price.IsZero(), "A missing price should be unset")
+	assert.Equal(t, "", item.Price.String())
+	assert.False(t, MustParseMoney("0.00").IsZero(), "0.00 is a set amount")
+	assert.NotEqual(t, Money{}, MustParseMoney("0.00"))
+}
+
+func TestMoney_Scan(t *testing.T) {
+	var m Money
+	assert.NoError(t, m.Scan("6.49"))
+	assert.Equal(t, MoneyFromCents(649), m)
+	assert.NoError(t, m.Scan([]byte("1.00")))
+	assert.Equal(t, MoneyFromCents(100), m)
+	assert.Error(t, m.Scan(6.49))
+
+	value, err := MustParseMoney("6.49").Value()
+	assert.NoError(t, err)
+	assert.Equal(t, "6.49", value)
+}
+
+func TestParseMultiplier(t *testing.T) {
+	for value, scaled := range map[string]int64{"0.2": 2000, "1": 10000, "1.5": 15000, "0.0001": 1} {
+		m, err := ParseMultiplier(value)
+		assert.NoError(t, err, "Error parsing %s", value)
+		assert.Equal(t, Multiplier(scaled), m)
+		assert.Equal(t, value, m.String())
+	}
+	assert.Equal(t, Multiplier(2000), MustParseMultiplier("0.2"))
+	assert.Panics(t, func() { MustParseMultiplier("0.00001") })
+	for _, value := range []string{"", ".2", "0.00001", "-0.2", "abc", "0.2x"} {
+		_, err := ParseMultiplier(value)
+		assert.Error(t, err, "Expected error parsing %q", value)
+	}
+}
+
+func TestMultiplier_YAML(t *testing.T) {
+	var params RuleParams
+	err := yaml.Unmarshal([]byte("priceMultiplier: 0.2\nmultiple: \"0.25\""), &params)
+	assert.NoError(t, err)
+	assert.Equal(t, Multiplier(2000), params.PriceMultiplier)
+	assert.Equal(t, MoneyFromCents(25), params.Multiple)
+}
+
+func TestMultiplier_CeilDollars(t *testing.T) {
+	m := Multiplier(2000)
+	assert.Equal(t, int64(1), m.CeilDollars(MustParseMoney("5.00")))
+	assert.Equal(t, int64(2), m.CeilDollars(MustParseMoney("5.01")))
+	assert.Equal(t, int64(3), m.CeilDollars(MustParseMoney("10.05")))
+	assert.Equal(t, int64(0), m.CeilDollars(MustParseMoney("0.00")))
+}
+
+func TestMultiplier_CeilLargestAmount(t *testing.T) {
+	largest := MustParseMoney("92233720368547757.99")
+	assert.Equal(t, int64(18446744073709552), Multiplier(2000).CeilDollars(largest))
+	assert.Equal(t, int64(1844674407370955160), Multiplier(2000).CeilCents(largest))
+	assert.Equal(t, largest.Cents(), Multiplier(10000).CeilCents(largest))
+	assert.Equal(t, int64(math.MaxInt64), Multiplier(15000).CeilCents(largest), "Results beyond int64 should be capped")
+	_, err := ParseMoney("92233720368547758.00")
+	assert.Error(t, err, "Larger amounts should be rejected")
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,279 +10,291 @@ import (
 func createRetailerTestReceipt(name string) Receipt {
 	receipt := Receipt{
 		Retailer:     name,
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "10.00"},
-			{ShortDescription: "Item02", Price: "10.00"},
+			{ShortDescription: "Item01", Price: MustParseMoney("10.00")},
+			{ShortDescription: "Item02", Price: MustParseMoney("10.00")},
 		},
-		Total: "20.00",
+		Total: MustParseMoney("20.00"),
 	}
 	return receipt
 }
 
+// Scores the receipt under a single rule from the default rule set
+func rulePoints(t *testing.T, receipt Receipt, name string) int64 {
+	for _, rule := range DefaultRuleSet().Rules {
+		if rule.Name == name {
+			result, err := rule.Evaluate(receipt)
+			if err != nil {
+				t.Fatalf("Error evaluating rule %s: %v", name, err)
+			}
+			return result.Points
+		}
+	}
+	t.Fatalf("No default rule named %s", name)
+	return -1
+}
+
 func TestGetNumAlphanumerical_NoChars(t *testing.T) {
 	receipt := createRetailerTestReceipt("")
-	value := receipt.getPointsAlphanumerical()
+	value := rulePoints(t, receipt, "retailerName")
 	assert.Equal(t, int64(0), value)
 }
 
 func TestGetNumAlphanumerical_OneChar(t *testing.T) {
 	receipt := createRetailerTestReceipt("a")
-	value := receipt.getPointsAlphanumerical()
+	value := rulePoints(t, receipt, "retailerName")
 	assert.Equal(t, int64(1), value)
 }
 func TestGetNumAlphanumerical_Valid01(t *testing.T) {
 	receipt := createRetailerTestReceipt("hello123world")
-	value := receipt.getPointsAlphanumerical()
+	value := rulePoints(t, receipt, "retailerName")
 	assert.Equal(t, int64(13), value)
 }
 func TestGetNumAlphanumerical_Valid02(t *testing.T) {
 	receipt := createRetailerTestReceipt("ABCDEF12345")
-	value := receipt.getPointsAlphanumerical()
+	value := rulePoints(t, receipt, "retailerName")
 	assert.Equal(t, int64(11), value)
 }
 func TestGetNumAlphanumerical_Valid03(t *testing.T) {
 	receipt := createRetailerTestReceipt(" hello world ")
-	value := receipt.getPointsAlphanumerical()
+	value := rulePoints(t, receipt, "retailerName")
 	assert.Equal(t, int64(10), value)
 }
 func TestGetNumAlphanumerical_Valid04(t *testing.T) {
 	receipt := createRetailerTestReceipt("h3110,w0r1d!")
-	value := receipt.getPointsAlphanumerical()
+	value := rulePoints(t, receipt, "retailerName")
 	assert.Equal(t, int64(10), value)
 }
 func TestGetNumAlphanumerical_Invalid(t *testing.T) {
 	receipt := createRetailerTestReceipt("!@#$%^&*")
-	value := receipt.getPointsAlphanumerical()
+	value := rulePoints(t, receipt, "retailerName")
 	assert.Equal(t, int64(0), value)
 }
 
 func TestGetPointsRoundAmount_Valid(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items:        []Item{},
-		Total:        "00.00",
+		Total:        MustParseMoney("00.00"),
 	}
-	value := receipt.getPointsRoundAmount()
+	value := rulePoints(t, receipt, "roundTotal")
 	assert.Equal(t, int64(50), value)
 }
 
 func TestGetPointsRoundAmount_NoPoints(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "0.50"},
-			{ShortDescription: "Item02", Price: "0.09"},
+			{ShortDescription: "Item01", Price: MustParseMoney("0.50")},
+			{ShortDescription: "Item02", Price: MustParseMoney("0.09")},
 		},
-		Total: "00.59",
+		Total: MustParseMoney("00.59"),
 	}
-	value := receipt.getPointsRoundAmount()
+	value := rulePoints(t, receipt, "roundTotal")
 	assert.Equal(t, int64(0), value)
 }
 
 func TestGetPointsMultipleOf25_00(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "5.00"},
-			{ShortDescription: "Item02", Price: "5.00"},
+			{ShortDescription: "Item01", Price: MustParseMoney("5.00")},
+			{ShortDescription: "Item02", Price: MustParseMoney("5.00")},
 		},
-		Total: "10.00",
+		Total: MustParseMoney("10.00"),
 	}
-	value := receipt.getPointsMultipleOf25()
+	value := rulePoints(t, receipt, "totalMultipleOf25")
 	assert.Equal(t, int64(25), value)
 }
 
 func TestGetPointsMultipleOf25_25(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "5.00"},
-			{ShortDescription: "Item02", Price: "5.25"},
+			{ShortDescription: "Item01", Price: MustParseMoney("5.00")},
+			{ShortDescription: "Item02", Price: MustParseMoney("5.25")},
 		},
-		Total: "10.25",
+		Total: MustParseMoney("10.25"),
 	}
-	value := receipt.getPointsMultipleOf25()
+	value := rulePoints(t, receipt, "totalMultipleOf25")
 	assert.Equal(t, int64(25), value)
 }
 
 func TestGetPointsMultipleOf25_50(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "0.25"},
-			{ShortDescription: "Item02", Price: "0.25"},
+			{ShortDescription: "Item01", Price: MustParseMoney("0.25")},
+			{ShortDescription: "Item02", Price: MustParseMoney("0.25")},
 		},
-		Total: "00.50",
+		Total: MustParseMoney("00.50"),
 	}
-	value := receipt.getPointsMultipleOf25()
+	value := rulePoints(t, receipt, "totalMultipleOf25")
 	assert.Equal(t, int64(25), value)
 }
 
 func TestGetPointsMultipleOf25_75(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "0.50"},
-			{ShortDescription: "Item02", Price: "0.25"},
+			{ShortDescription: "Item01", Price: MustParseMoney("0.50")},
+			{ShortDescription: "Item02", Price: MustParseMoney("0.25")},
 		},
-		Total: "00.75",
+		Total: MustParseMoney("00.75"),
 	}
-	value := receipt.getPointsMultipleOf25()
+	value := rulePoints(t, receipt, "totalMultipleOf25")
 	assert.Equal(t, int64(25), value)
 }
 
 func TestGetPointsMultipleOf25_NoPoints(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "0.50"},
-			{ShortDescription: "Item02", Price: "0.49"},
+			{ShortDescription: "Item01", Price: MustParseMoney("0.50")},
+			{ShortDescription: "Item02", Price: MustParseMoney("0.49")},
 		},
-		Total: "00.99",
+		Total: MustParseMoney("00.99"),
 	}
-	value := receipt.getPointsMultipleOf25()
+	value := rulePoints(t, receipt, "totalMultipleOf25")
 	assert.Equal(t, int64(0), value)
 }
 
 func TestGetPointsForOddDate_Odd(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "0.50"},
-			{ShortDescription: "Item02", Price: "0.49"},
+			{ShortDescription: "Item01", Price: MustParseMoney("0.50")},
+			{ShortDescription: "Item02", Price: MustParseMoney("0.49")},
 		},
-		Total: "00.99",
+		Total: MustParseMoney("00.99"),
 	}
-	value := receipt.getPointsForOddDate()
+	value := rulePoints(t, receipt, "oddPurchaseDay")
 	assert.Equal(t, int64(6), value)
 }
 
 func TestGetPointsForOddDate_Even(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-02",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-02"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "0.50"},
-			{ShortDescription: "Item02", Price: "0.49"},
+			{ShortDescription: "Item01", Price: MustParseMoney("0.50")},
+			{ShortDescription: "Item02", Price: MustParseMoney("0.49")},
 		},
-		Total: "00.99",
+		Total: MustParseMoney("00.99"),
 	}
-	value := receipt.getPointsForOddDate()
+	value := rulePoints(t, receipt, "oddPurchaseDay")
 	assert.Equal(t, int64(0), value)
 }
 
 func TestGetPointsForTimeOfPurchase_1PM(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-02",
-		PurchaseTime: "13:00",
+		PurchaseDate: MustParseDate("2022-01-02"),
+		PurchaseTime: MustParseTimeOfDay("13:00"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "0.50"},
-			{ShortDescription: "Item02", Price: "0.49"},
+			{ShortDescription: "Item01", Price: MustParseMoney("0.50")},
+			{ShortDescription: "Item02", Price: MustParseMoney("0.49")},
 		},
-		Total: "00.99",
+		Total: MustParseMoney("00.99"),
 	}
-	value := receipt.getPointsForTimeOfPurchase()
+	value := rulePoints(t, receipt, "purchaseTime")
 	assert.Equal(t, int64(0), value)
 }
 
 func TestGetPointsForTimeOfPurchase_2PM(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-02",
-		PurchaseTime: "14:00",
+		PurchaseDate: MustParseDate("2022-01-02"),
+		PurchaseTime: MustParseTimeOfDay("14:00"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "0.50"},
-			{ShortDescription: "Item02", Price: "0.49"},
+			{ShortDescription: "Item01", Price: MustParseMoney("0.50")},
+			{ShortDescription: "Item02", Price: MustParseMoney("0.49")},
 		},
-		Total: "00.99",
+		Total: MustParseMoney("00.99"),
 	}
-	value := receipt.getPointsForTimeOfPurchase()
+	value := rulePoints(t, receipt, "purchaseTime")
 	assert.Equal(t, int64(10), value)
 }
 func TestGetPointsForTimeOfPurchase_3PM(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-02",
-		PurchaseTime: "15:00",
+		PurchaseDate: MustParseDate("2022-01-02"),
+		PurchaseTime: MustParseTimeOfDay("15:00"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "0.50"},
-			{ShortDescription: "Item02", Price: "0.49"},
+			{ShortDescription: "Item01", Price: MustParseMoney("0.50")},
+			{ShortDescription: "Item02", Price: MustParseMoney("0.49")},
 		},
-		Total: "00.99",
+		Total: MustParseMoney("00.99"),
 	}
-	value := receipt.getPointsForTimeOfPurchase()
+	value := rulePoints(t, receipt, "purchaseTime")
 	assert.Equal(t, int64(10), value)
 }
 func TestGetPointsForTimeOfPurchase_4PM(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-02",
-		PurchaseTime: "16:00",
+		PurchaseDate: MustParseDate("2022-01-02"),
+		PurchaseTime: MustParseTimeOfDay("16:00"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "0.50"},
-			{ShortDescription: "Item02", Price: "0.49"},
+			{ShortDescription: "Item01", Price: MustParseMoney("0.50")},
+			{ShortDescription: "Item02", Price: MustParseMoney("0.49")},
 		},
-		Total: "00.99",
+		Total: MustParseMoney("00.99"),
 	}
-	value := receipt.getPointsForTimeOfPurchase()
+	value := rulePoints(t, receipt, "purchaseTime")
 	assert.Equal(t, int64(0), value)
 }
 
 func TestGetPointsForItems(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
-			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
-			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
-			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
-			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+			{ShortDescription: "Mountain Dew 12PK", Price: MustParseMoney("6.49")},
+			{ShortDescription: "Emils Cheese Pizza", Price: MustParseMoney("12.25")},
+			{ShortDescription: "Knorr Creamy Chicken", Price: MustParseMoney("1.26")},
+			{ShortDescription: "Doritos Nacho Cheese", Price: MustParseMoney("3.35")},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: MustParseMoney("12.00")},
 		},
-		Total: "35.35",
+		Total: MustParseMoney("35.35"),
 	}
 
-	value, err := receipt.getPointsForItems()
-	if err != nil {
-		t.Fatalf("Error calculating points for items: %v", err)
-	}
+	value := rulePoints(t, receipt, "itemDescription")
 	assert.Equal(t, int64(6), value)
 }
 
 func TestReceiptPoints_SuccessPath(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Target",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
-			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
-			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
-			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
-			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+			{ShortDescription: "Mountain Dew 12PK", Price: MustParseMoney("6.49")},
+			{ShortDescription: "Emils Cheese Pizza", Price: MustParseMoney("12.25")},
+			{ShortDescription: "Knorr Creamy Chicken", Price: MustParseMoney("1.26")},
+			{ShortDescription: "Doritos Nacho Cheese", Price: MustParseMoney("3.35")},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: MustParseMoney("12.00")},
 		},
-		Total: "01.64",
+		Total: MustParseMoney("01.64"),
 	}
 	points, err := receipt.Points()
 	if err != nil {
@@ -293,12 +306,12 @@ func TestReceiptPoints_SuccessPath(t *testing.T) {
 func TestReceiptPointsForTotal25(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "14:00",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("14:00"),
 		Items: []Item{
-			{ShortDescription: "Dew 12PK", Price: "25.00"},
+			{ShortDescription: "Dew 12PK", Price: MustParseMoney("25.00")},
 		},
-		Total: "25.00",
+		Total: MustParseMoney("25.00"),
 	}
 	points, err := receipt.Points()
 	if err != nil {
@@ -310,16 +323,16 @@ func TestReceiptPointsForTotal25(t *testing.T) {
 func TestReceiptPointsWithFourItems(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Target",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Mountain Dew 12PK", Price: "6.49"},
-			{ShortDescription: "Emils Cheese Pizza", Price: "12.25"},
-			{ShortDescription: "Knorr Creamy Chicken", Price: "1.26"},
-			{ShortDescription: "Doritos Nacho Cheese", Price: "3.35"},
-			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: "12.00"},
+			{ShortDescription: "Mountain Dew 12PK", Price: MustParseMoney("6.49")},
+			{ShortDescription: "Emils Cheese Pizza", Price: MustParseMoney("12.25")},
+			{ShortDescription: "Knorr Creamy Chicken", Price: MustParseMoney("1.26")},
+			{ShortDescription: "Doritos Nacho Cheese", Price: MustParseMoney("3.35")},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: MustParseMoney("12.00")},
 		},
-		Total: "35.35",
+		Total: MustParseMoney("35.35"),
 	}
 	points, err := receipt.Points()
 	if err != nil {
@@ -331,12 +344,12 @@ func TestReceiptPointsWithFourItems(t *testing.T) {
 func TestPointsForOddPurchaseDate(t *testing.T) {
 	receipt := Receipt{
 		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "10.00"},
+			{ShortDescription: "Item01", Price: MustParseMoney("10.00")},
 		},
-		Total: "10.00",
+		Total: MustParseMoney("10.00"),
 	}
 	points, err := receipt.Points()
 	if err != nil {
@@ -346,16 +359,54 @@ func TestPointsForOddPurchaseDate(t *testing.T) {
 }
 
 func TestPointsForInvalidItems(t *testing.T) {
+	// Prices are parsed before scoring, so an invalid price never reaches the rules
+	var item Item
+	err := json.Unmarshal([]byte(`{"shortDescription": "Item01", "price": "10.00.12"}`), &item)
+	assert.NotNil(t, err, "Error should be returned")
+}
+
+func TestReceiptBreakdown_MatchesPoints(t *testing.T) {
 	receipt := Receipt{
-		Retailer:     "Test Retailer",
-		PurchaseDate: "2022-01-01",
-		PurchaseTime: "13:01",
+		Retailer:     "Target",
+		PurchaseDate: MustParseDate("2022-01-01"),
+		PurchaseTime: MustParseTimeOfDay("13:01"),
 		Items: []Item{
-			{ShortDescription: "Item01", Price: "10.00.12"},
+			{ShortDescription: "Mountain Dew 12PK", Price: MustParseMoney("6.49")},
+			{ShortDescription: "Emils Cheese Pizza", Price: MustParseMoney("12.25")},
+			{ShortDescription: "Knorr Creamy Chicken", Price: MustParseMoney("1.26")},
+			{ShortDescription: "Doritos Nacho Cheese", Price: MustParseMoney("3.35")},
+			{ShortDescription: "   Klarbrunn 12-PK 12 FL OZ  ", Price: MustParseMoney("12.00")},
 		},
-		Total: "20.00",
+		Total: MustParseMoney("35.35"),
 	}
-	points, err := receipt.Points()
-	assert.NotNil(t, err, "Error should be returned")
-	assert.Equal(t, int64(-1), points)
+	breakdown, err := receipt.Breakdown()
+	if err != nil {
+		t.Fatalf("Error calculating breakdown for receipt: %v", err)
+	}
+	assert.Equal(t, int64(28), breakdown.Points)
+
+	byRule := map[string]RuleResult{}
+	for _, rule := range breakdown.Rules {
+		byRule[rule.Rule] = rule
+	}
+	assert.Len(t, byRule, 7, "Every rule should be reported")
+	assert.Equal(t, int64(6), byRule["retailerName"].Points)
+	assert.Equal(t, int64(10), byRule["itemPairs"].Points)
+	assert.Equal(t, int64(6), byRule["itemDescription"].Points)
+	assert.Equal(t, int64(6), byRule["oddPurchaseDay"].Points)
+	assert.Equal(t, int64(0), byRule["roundTotal"].Points)
+
+	items := byRule["itemDescription"].Items
+	assert.Len(t, items, 5, "Every item should be reported")
+	assert.Equal(t, 24, items[4].TrimmedLength)
+	assert.Equal(t, int64(3), items[4].Points)
+	assert.Equal(t, int64(0), items[0].Points)
+	assert.NotEmpty(t, items[0].Reason)
+}
+
+func TestReceiptBreakdown_MissingDate(t *testing.T) {
+	receipt := createRetailerTestReceipt("Target")
+	receipt.PurchaseDate = Date{}
+	_, err := receipt.Breakdown()
+	assert.Error(t, err, "Error should be returned")
 }
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// RuleRegistry holds every known version of the rules. New receipts are
+// scored under the current version, older versions stay available so stored
+// receipts can be explained and rescored.
+type RuleRegistry struct {
+	versions map[int]RuleSet
+	current  int
+}
+
+// Builds a registry from the given rule sets. The current version is the one
+// requested, or the highest version when current is zero.
+func NewRuleRegistry(current int, sets ...RuleSet) (*RuleRegistry, error) {
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("no rule sets")
+	}
+	registry := &RuleRegistry{versions: map[int]RuleSet{}, current: current}
+	for _, set := range sets {
+		if _, ok := registry.versions[set.Version]; ok {
+			return nil, fmt.Errorf("rule set version %d is defined more than once", set.Version)
+		}
+		registry.versions[set.Version] = set
+		if current == 0 && set.Version > registry.current {
+			registry.current = set.Version
+		}
+	}
+	if _, ok := registry.versions[registry.current]; !ok {
+		return nil, fmt.Errorf("current rule set version %d is not defined", registry.current)
+	}
+	return registry, nil
+}
+
+// Loads every *.yml file in dir as a rule set version
+func LoadRuleRegistry(dir string, current int) (*RuleRegistry, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yml"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, fmt.Errorf("error reading rules directory: %w", err)
+		}
+		return nil, fmt.Errorf("no rule files found in %s", dir)
+	}
+
+	sets := make([]RuleSet, 0, len(files))
+	for _, file := range files {
+		set, err := LoadRuleSet(file)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, set)
+	}
+	return NewRuleRegistry(current, sets...)
+}
+
+// Registry holding only the default rules
+func DefaultRuleRegistry() *RuleRegistry {
+	registry, _ := NewRuleRegistry(0, DefaultRuleSet())
+	return registry
+}
+
+// The rule set new receipts are scored under
+func (r *RuleRegistry) Current() RuleSet {
+	return r.versions[r.current]
+}
+
+func (r *RuleRegistry) Version(version int) (RuleSet, bool) {
+	set, ok := r.versions[version]
+	return set, ok
+}
+
+// Every known version in ascending order
+func (r *RuleRegistry) Versions() []int {
+	versions := make([]int, 0, len(r.versions))
+	for version := range r.versions {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
@@ -0,0 +1,267 @@
+package models
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rule types understood by the points engine
+const (
+	// Points for every letter or digit in the retailer name
+	RuleAlphanumeric = "alphanumeric"
+	// Points when the total has no cents
+	RuleRoundTotal = "roundTotal"
+	// Points when the total is a multiple of params.multiple
+	RuleTotalMultiple = "totalMultiple"
+	// Points for every params.groupSize items on the receipt
+	RuleItemGroups = "itemGroups"
+	// Price times params.priceMultiplier, rounded up, for every item whose
+	// trimmed description length is a multiple of params.lengthMultiple
+	RuleDescriptionLength = "descriptionLength"
+	// Points when the day of the purchase date is odd
+	RuleOddDay = "oddDay"
+	// Points when the purchase time is at or after params.start and before params.end
+	RuleTimeWindow = "timeWindow"
+)
+
+// Parameters used by the rule types, each type only reads the ones it needs
+type RuleParams struct {
+	Points          int64      `yaml:"points,omitempty"`
+	Multiple        Money      `yaml:"multiple,omitempty"`
+	GroupSize       int        `yaml:"groupSize,omitempty"`
+	LengthMultiple  int        `yaml:"lengthMultiple,omitempty"`
+	PriceMultiplier Multiplier `yaml:"priceMultiplier,omitempty"`
+	Start           TimeOfDay  `yaml:"start,omitempty"`
+	End             TimeOfDay  `yaml:"end,omitempty"`
+}
+
+type Rule struct {
+	Name    string     `yaml:"name"`
+	Type    string     `yaml:"type"`
+	Enabled bool       `yaml:"enabled"`
+	Params  RuleParams `yaml:"params"`
+}
+
+// RuleSet is an ordered list of rules, a receipt's points are the sum of the
+// points awarded by every enabled rule. Receipts remember the version of the
+// rule set that scored them, so a changed rule set must get a new version.
+type RuleSet struct {
+	Version int    `yaml:"version"`
+	Rules   []Rule `yaml:"rules"`
+}
+
+// Returns the rules described in the README
+func DefaultRuleSet() RuleSet {
+	return RuleSet{Version: 1, Rules: []Rule{
+		{Name: "retailerName", Type: RuleAlphanumeric, Enabled: true, Params: RuleParams{Points: 1}},
+		{Name: "roundTotal", Type: RuleRoundTotal, Enabled: true, Params: RuleParams{Points: 50}},
+		{Name: "totalMultipleOf25", Type: RuleTotalMultiple, Enabled: true, Params: RuleParams{Multiple: MustParseMoney("0.25"), Points: 25}},
+		{Name: "itemPairs", Type: RuleItemGroups, Enabled: true, Params: RuleParams{GroupSize: 2, Points: 5}},
+		{Name: "itemDescription", Type: RuleDescriptionLength, Enabled: true, Params: RuleParams{LengthMultiple: 3, PriceMultiplier: MustParseMultiplier("0.2")}},
+		{Name: "oddPurchaseDay", Type: RuleOddDay, Enabled: true, Params: RuleParams{Points: 6}},
+		{Name: "purchaseTime", Type: RuleTimeWindow, Enabled: true, Params: RuleParams{Start: MustParseTimeOfDay("14:00"), End: MustParseTimeOfDay("16:00"), Points: 10}},
+	}}
+}
+
+func LoadRuleSet(path string) (RuleSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return RuleSet{}, fmt.Errorf("error reading rule file: %w", err)
+	}
+	rules, err := ParseRuleSet(data)
+	if err != nil {
+		return RuleSet{}, fmt.Errorf("invalid rule file %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// Decodes and validates a YAML rule set, unknown fields are rejected
+func ParseRuleSet(data []byte) (RuleSet, error) {
+	var rules RuleSet
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&rules); err != nil {
+		return RuleSet{}, err
+	}
+	if err := rules.Validate(); err != nil {
+		return RuleSet{}, err
+	}
+	return rules, nil
+}
+
+func (rs RuleSet) Validate() error {
+	if rs.Version <= 0 {
+		return fmt.Errorf("rule set version must be a positive number")
+	}
+	if len(rs.Rules) == 0 {
+		return fmt.Errorf("rule set has no rules")
+	}
+	names := map[string]bool{}
+	for i, rule := range rs.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("rule %d has no name", i)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("rule name %s is used more than once", rule.Name)
+		}
+		names[rule.Name] = true
+		if err := rule.Validate(); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func (rule Rule) Validate() error {
+	p := rule.Params
+	switch rule.Type {
+	case RuleAlphanumeric, RuleRoundTotal, RuleOddDay:
+	case RuleTotalMultiple:
+		if p.Multiple.Cents() <= 0 {
+			return fmt.Errorf("multiple must be a positive cash value such as 0.25")
+		}
+	case RuleItemGroups:
+		if p.GroupSize <= 0 {
+			return fmt.Errorf("groupSize must be positive")
+		}
+	case RuleDescriptionLength:
+		if p.LengthMultiple <= 0 {
+			return fmt.Errorf("lengthMultiple must be positive")
+		}
+		if p.PriceMultiplier <= 0 {
+			return fmt.Errorf("priceMultiplier must be positive")
+		}
+	case RuleTimeWindow:
+		if p.Start.IsZero() || p.End.IsZero() {
+			return fmt.Errorf("start and end must be times such as 14:00")
+		}
+		if !p.Start.Before(p.End) {
+			return fmt.Errorf("start must be before end")
+		}
+	default:
+		return fmt.Errorf("unknown rule type %q", rule.Type)
+	}
+	return nil
+}
+
+// Returns the result of every enabled rule
+func (rs RuleSet) Breakdown(r Receipt) (PointsBreakdown, error) {
+	breakdown := PointsBreakdown{RuleVersion: rs.Version, Rules: []RuleResult{}}
+	for _, rule := range rs.Rules {
+		if !rule.Enabled {
+			continue
+		}
+		result, err := rule.Evaluate(r)
+		if err != nil {
+			return PointsBreakdown{}, err
+		}
+		breakdown.Rules = append(breakdown.Rules, result)
+		breakdown.Points += result.Points
+	}
+	return breakdown, nil
+}
+
+func (rs RuleSet) Points(r Receipt) (int64, error) {
+	breakdown, err := rs.Breakdown(r)
+	if err != nil {
+		// return error
+		return -1, err
+	}
+	return breakdown.Points, nil
+}
+
+// Scores the receipt under this rule alone, whether or not it is enabled
+func (rule Rule) Evaluate(r Receipt) (RuleResult, error) {
+	result := RuleResult{Rule: rule.Name}
+	p := rule.Params
+	switch rule.Type {
+	case RuleAlphanumeric:
+		count := int64(0)
+		for _, c := range r.Retailer {
+			if unicode.IsLetter(c) || unicode.IsNumber(c) {
+				count++
+			}
+		}
+		result.Points = count * p.Points
+		result.Reason = fmt.Sprintf("retailer name (%s) has %d alphanumeric characters", r.Retailer, count)
+
+	case RuleRoundTotal:
+		result.Reason = "total is not a round dollar amount"
+		if r.Total.Cents()%100 == 0 {
+			result.Points = p.Points
+			result.Reason = "total is a round dollar amount"
+		}
+
+	case RuleTotalMultiple:
+		result.Reason = fmt.Sprintf("total is not a multiple of %s", p.Multiple)
+		if r.Total.Cents()%p.Multiple.Cents() == 0 {
+			result.Points = p.Points
+			result.Reason = fmt.Sprintf("total is a multiple of %s", p.Multiple)
+		}
+
+	case RuleItemGroups:
+		groups := len(r.Items) / p.GroupSize
+		result.Points = int64(groups) * p.Points
+		result.Reason = fmt.Sprintf("%d items (%d groups of %d @ %d points each)", len(r.Items), groups, p.GroupSize, p.Points)
+
+	case RuleDescriptionLength:
+		items := rule.itemPoints(r)
+		for _, item := range items {
+			result.Points += item.Points
+		}
+		result.Items = items
+		result.Reason = fmt.Sprintf("items whose trimmed description length is a multiple of %d earn %s times their price, rounded up",
+			p.LengthMultiple, p.PriceMultiplier)
+
+	case RuleOddDay:
+		if r.PurchaseDate.IsZero() {
+			return result, fmt.Errorf("receipt has no purchase date")
+		}
+		result.Reason = "purchase day is even"
+		if r.PurchaseDate.Day()%2 == 1 {
+			result.Points = p.Points
+			result.Reason = "purchase day is odd"
+		}
+
+	case RuleTimeWindow:
+		if r.PurchaseTime.IsZero() {
+			return result, fmt.Errorf("receipt has no purchase time")
+		}
+		result.Reason = fmt.Sprintf("%s is not between %s and %s", r.PurchaseTime, p.Start, p.End)
+		if !r.PurchaseTime.Before(p.Start) && r.PurchaseTime.Before(p.End) {
+			result.Points = p.Points
+			result.Reason = fmt.Sprintf("%s is between %s and %s", r.PurchaseTime, p.Start, p.End)
+		}
+
+	default:
+		return result, fmt.Errorf("unknown rule type %q", rule.Type)
+	}
+	return result, nil
+}
+
+func (rule Rule) itemPoints(r Receipt) []ItemPoints {
+	p := rule.Params
+	items := make([]ItemPoints, 0, len(r.Items))
+	for _, curr_item := range r.Items {
+		trimmed := strings.Trim(curr_item.ShortDescription, " ")
+		item := ItemPoints{
+			ShortDescription: curr_item.ShortDescription,
+			Price:            curr_item.Price,
+			TrimmedLength:    len(trimmed),
+		}
+		if len(trimmed)%p.LengthMultiple == 0 {
+			item.Points = p.PriceMultiplier.CeilDollars(curr_item.Price)
+			item.Reason = fmt.Sprintf("%q is %d characters (a multiple of %d), item price of %s * %s rounded up is %d points",
+				trimmed, len(trimmed), p.LengthMultiple, curr_item.Price, p.PriceMultiplier, item.Points)
+		} else {
+			item.Reason = fmt.Sprintf("%q is %d characters (not a multiple of %d)", trimmed, len(trimmed), p.LengthMultiple)
+		}
+		items = append(items, item)
+	}
+	return items
+}
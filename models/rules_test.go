@@ -0,0 +1,139 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRuleSet_MatchesDefault(t *testing.T) {
+	rules, err := LoadRuleSet("../rules/v1.yml")
+	assert.NoError(t, err, "Error loading rules")
+	assert.Equal(t, DefaultRuleSet(), rules, "Shipped rules should reproduce the default rules")
+}
+
+func TestLoadRuleSet_NoFile(t *testing.T) {
+	_, err := LoadRuleSet("noExist.yml")
+	assert.Error(t, err, "Expected error loading rules")
+}
+
+func TestParseRuleSet_Invalid(t *testing.T) {
+	invalid := map[string]string{
+		"no version":     "rules:\n  - {name: a, type: oddDay, enabled: true}",
+		"empty":          "version: 1\nrules: []",
+		"unknown type":   "version: 1\nrules:\n  - {name: a, type: lottery, enabled: true}",
+		"unknown field":  "version: 1\nrules:\n  - {name: a, type: oddDay, enabled: true, bonus: 3}",
+		"duplicate name": "version: 1\nrules:\n  - {name: a, type: oddDay, enabled: true}\n  - {name: a, type: roundTotal, enabled: true}",
+		"no name":        "version: 1\nrules:\n  - {type: oddDay, enabled: true}",
+		"bad multiple":   "version: 1\nrules:\n  - {name: a, type: totalMultiple, enabled: true, params: {multiple: abc}}",
+		"no group size":  "version: 1\nrules:\n  - {name: a, type: itemGroups, enabled: true, params: {points: 5}}",
+		"no multiplier":  "version: 1\nrules:\n  - {name: a, type: descriptionLength, enabled: true, params: {lengthMultiple: 3}}",
+		"no length":      "version: 1\nrules:\n  - {name: a, type: descriptionLength, enabled: true, params: {priceMultiplier: 0.2}}",
+		"bad window":     "version: 1\nrules:\n  - {name: a, type: timeWindow, enabled: true, params: {start: \"16:00\", end: \"14:00\"}}",
+		"bad time":       "version: 1\nrules:\n  - {name: a, type: timeWindow, enabled: true, params: {start: \"2pm\", end: \"16:00\"}}",
+		"not yaml":       "rules: [",
+	}
+	for name, data := range invalid {
+		_, err := ParseRuleSet([]byte(data))
+		assert.Error(t, err, "Expected error for %s", name)
+	}
+}
+
+func TestRuleSet_CustomParams(t *testing.T) {
+	rules, err := ParseRuleSet([]byte(`
+version: 2
+rules:
+    - name: retailer
+      type: alphanumeric
+      enabled: true
+      params: {points: 2}
+    - name: triples
+      type: itemGroups
+      enabled: true
+      params: {groupSize: 3, points: 7}
+    - name: morning
+      type: timeWindow
+      enabled: true
+      params: {start: "08:00", end: "09:00", points: 4}
+    - name: round
+      type: roundTotal
+      enabled: false
+      params: {points: 50}
+`))
+	assert.NoError(t, err, "Error parsing rules")
+
+	receipt := Receipt{
+		Retailer:     "Walgreens",
+		PurchaseDate: MustParseDate("2022-01-02"),
+		PurchaseTime: MustParseTimeOfDay("08:13"),
+		Items: []Item{
+			{ShortDescription: "Pepsi - 12-oz", Price: MustParseMoney("1.25")},
+			{ShortDescription: "Dasani", Price: MustParseMoney("1.40")},
+			{ShortDescription: "Dasani", Price: MustParseMoney("1.40")},
+		},
+		Total: MustParseMoney("4.00"),
+	}
+	breakdown, err := rules.Breakdown(receipt)
+	assert.NoError(t, err, "Error scoring receipt")
+	assert.Len(t, breakdown.Rules, 3, "Disabled rules should be skipped")
+	assert.Equal(t, int64(2*9+7+4), breakdown.Points)
+}
+
+func TestRuleSet_TimeWindowBounds(t *testing.T) {
+	rule := Rule{Name: "window", Type: RuleTimeWindow, Enabled: true, Params: RuleParams{Start: MustParseTimeOfDay("14:00"), End: MustParseTimeOfDay("16:00"), Points: 10}}
+	for purchaseTime, expected := range map[string]int64{"13:59": 0, "14:00": 10, "15:59": 10, "16:00": 0} {
+		receipt := createRetailerTestReceipt("Target")
+		receipt.PurchaseTime = MustParseTimeOfDay(purchaseTime)
+		result, err := rule.Evaluate(receipt)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, result.Points, "Unexpected points at %s", purchaseTime)
+	}
+}
+
+func TestRuleSet_DescriptionLengthBoundaries(t *testing.T) {
+	// 15.00 * 0.2 is 3.0000000000000004 in floating point, which used to round up to 4
+	for price, expected := range map[string]int64{"5.00": 1, "10.05": 3, "15.00": 3, "35.00": 7, "0.01": 1, "0.00": 0, "12.25": 3} {
+		receipt := createRetailerTestReceipt("Target")
+		receipt.Items = []Item{{ShortDescription: "abc", Price: MustParseMoney(price)}}
+		assert.Equal(t, expected, rulePoints(t, receipt, "itemDescription"), "Unexpected points for price %s", price)
+	}
+}
+
+func TestLoadRuleRegistry(t *testing.T) {
+	registry, err := LoadRuleRegistry("../rules", 0)
+	assert.NoError(t, err, "Error loading rules")
+	assert.Equal(t, DefaultRuleSet(), registry.Current())
+	assert.Equal(t, []int{1}, registry.Versions())
+}
+
+func TestLoadRuleRegistry_NoDirectory(t *testing.T) {
+	_, err := LoadRuleRegistry("noExist", 0)
+	assert.Error(t, err, "Expected error loading rules")
+}
+
+func TestNewRuleRegistry_Versions(t *testing.T) {
+	v2 := DefaultRuleSet()
+	v2.Version = 2
+	v2.Rules = v2.Rules[:1]
+
+	registry, err := NewRuleRegistry(0, DefaultRuleSet(), v2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, registry.Current().Version, "Highest version should be current")
+	assert.Equal(t, []int{1, 2}, registry.Versions())
+
+	pinned, err := NewRuleRegistry(1, DefaultRuleSet(), v2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pinned.Current().Version, "Requested version should be current")
+	found, ok := pinned.Version(2)
+	assert.True(t, ok)
+	assert.Equal(t, v2, found)
+	_, ok = pinned.Version(3)
+	assert.False(t, ok)
+
+	_, err = NewRuleRegistry(3, DefaultRuleSet(), v2)
+	assert.Error(t, err, "Unknown current version should fail")
+	_, err = NewRuleRegistry(0, DefaultRuleSet(), DefaultRuleSet())
+	assert.Error(t, err, "Duplicate versions should fail")
+	_, err = NewRuleRegistry(0)
+	assert.Error(t, err, "Empty registry should fail")
+}
@@ -1,28 +1,151 @@
 package router
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/gin-contrib/requestid"
+	ginzap "github.com/gin-contrib/zap"
 	"github.com/go-playground/validator/v10"
+	"github.com/jiyo4476/receipt-processor-challenge/docs"
 	"github.com/jiyo4476/receipt-processor-challenge/handlers"
+	"github.com/jiyo4476/receipt-processor-challenge/middleware"
 	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/jiyo4476/receipt-processor-challenge/spec"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
-func SetUpRouter() *gin.Engine {
+// Dependencies of the routes, zero values fall back to the defaults
+type Config struct {
+	Receipts store.ReceiptStore
+	Rules    *models.RuleRegistry
+	// An empty mode falls back to models.DefaultConsistencyMode
+	Consistency models.ConsistencyPolicy
+	// Empty falls back to models.DefaultDuplicatePolicy
+	Duplicates models.DuplicatePolicy
+	// How long responses are replayed for a repeated Idempotency-Key
+	IdempotencyWindow time.Duration
+	// Checks the API key of every request, nil turns authentication off
+	Auth *middleware.Authenticator
+	// Limits per client, nil turns rate limiting off
+	RateLimits *middleware.RateLimitConfig
+	// OpenAPI document requests are validated against and that is served at
+	// /openapi.yaml, /openapi.json and /docs, nil turns both off
+	Spec *spec.Spec
+	// Base URL the served document gives as its server
+	ServerURL string
+	// Logs responses that do not match Spec, meant for debug mode
+	ValidateResponses bool
+	// Proxies whose X-Forwarded-For header is used for the client IP, none
+	// are trusted when empty
+	TrustedProxies []string
+}
+
+func SetUpRouter(cfg Config) *gin.Engine {
 	//router := gin.Default()
 	router := gin.New()
 
 	// Register custom validation functions for the test router
 	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
-		v.RegisterValidation("correctRetailerName", models.CorrectRetailerName)
-		v.RegisterValidation("correctShortDescription", models.CorrectShortDescription)
-		v.RegisterValidation("correctCashValue", models.CorrectCashValue)
-		v.RegisterValidation("correctDate", models.CorrectDate)
-		v.RegisterValidation("correctTime", models.CorrectTime)
+		models.RegisterValidators(v)
+	}
+
+	if cfg.Receipts == nil {
+		cfg.Receipts = store.NewMemoryStore()
+	}
+	if cfg.Rules == nil {
+		cfg.Rules = models.DefaultRuleRegistry()
 	}
+	if cfg.Consistency.Mode == "" {
+		cfg.Consistency.Mode = models.DefaultConsistencyMode
+	}
+	if cfg.IdempotencyWindow == 0 {
+		cfg.IdempotencyWindow = 24 * time.Hour
+	}
+	if cfg.Duplicates == "" {
+		cfg.Duplicates = models.DefaultDuplicatePolicy
+	}
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		zap.L().Error(fmt.Sprintf("Invalid trusted proxies, trusting none: %v", err))
+		_ = router.SetTrustedProxies(nil)
+	}
+
+	// Middleware has to be added before the routes to apply to them
+	router.Use(requestid.New())
+	logger := zap.L()
+	router.Use(ginzap.GinzapWithConfig(logger, &ginzap.Config{
+		UTC:        true,
+		TimeFormat: time.RFC3339,
+		Context: ginzap.Fn(func(c *gin.Context) []zapcore.Field {
+			fields := []zapcore.Field{}
+			// log request ID
+			if requestID := requestid.Get(c); requestID != "" {
+				fields = append(fields, zap.String("request_id", requestID))
+			}
 
-	router.POST("/receipts/process", handlers.ProcessReceipt)
-	router.GET("/receipts/:id/points", handlers.GetReceiptsPoints)
+			return fields
+		}),
+	}))
+	router.Use(ginzap.RecoveryWithZap(logger, true))
+	if cfg.Spec != nil && cfg.ValidateResponses {
+		router.Use(middleware.ValidateResponses(cfg.Spec, middleware.LogResponseViolations))
+	}
+	var limiter *middleware.RateLimiter
+	if cfg.RateLimits != nil {
+		limiter = middleware.NewRateLimiter(*cfg.RateLimits)
+	}
+	if cfg.Auth != nil {
+		// Addresses are limited before credentials are checked, so invalid
+		// keys cannot be tried without limit
+		if limiter != nil {
+			router.Use(limiter.HandleIP)
+		}
+		router.Use(cfg.Auth.Handle)
+	}
+	if limiter != nil {
+		router.Use(limiter.Handle)
+	}
+	if cfg.Spec != nil {
+		router.Use(middleware.ValidateRequests(cfg.Spec))
+	}
+
+	h := handlers.New(cfg.Receipts, cfg.Rules, cfg.Consistency, cfg.Duplicates)
+	idempotency := middleware.NewIdempotency(cfg.IdempotencyWindow)
+
+	// Scopes are only checked when authentication is on
+	read := cfg.Auth.RequireScope(middleware.ScopeRead)
+	write := cfg.Auth.RequireScope(middleware.ScopeWrite)
+	admin := cfg.Auth.RequireScope(middleware.ScopeAdmin)
+
+	router.POST("/receipts/process", write, idempotency.Handle, h.ProcessReceipt)
+	router.POST("/receipts/batch", write, idempotency.Handle, h.ProcessBatch)
+	router.POST("/receipts/stream", write, h.ProcessStream)
+	router.POST("/receipts/import", admin, h.ImportReceipts)
+	router.GET("/receipts", read, h.ListReceipts)
+	router.GET("/receipts/:id", read, h.GetReceipt)
+	router.PUT("/receipts/:id", write, h.ReplaceReceipt)
+	router.PATCH("/receipts/:id", write, h.PatchReceipt)
+	router.DELETE("/receipts/:id", admin, h.DeleteReceipt)
+	router.GET("/receipts/:id/history", read, h.GetReceiptHistory)
+	router.GET("/receipts/:id/points", read, h.GetReceiptsPoints)
+	router.GET("/receipts/:id/points/breakdown", read, h.GetReceiptsPointsBreakdown)
+
+	// The document and its docs page are public
+	if cfg.Spec != nil {
+		documentation, err := docs.New(cfg.Spec, cfg.ServerURL)
+		if err != nil {
+			zap.L().Error(fmt.Sprintf("Not serving the spec: %v", err))
+			return router
+		}
+		router.GET("/openapi.yaml", documentation.YAML)
+		router.GET("/openapi.json", documentation.JSON)
+		router.GET("/docs", documentation.Page)
+		router.StaticFS("/docs/assets", docs.Assets())
+	}
 	return router
 }
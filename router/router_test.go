@@ -1,17 +1,168 @@
 package router
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/jiyo4476/receipt-processor-challenge/middleware"
+	"github.com/jiyo4476/receipt-processor-challenge/spec"
+	"github.com/jiyo4476/receipt-processor-challenge/spec/spectest"
+	"github.com/jiyo4476/receipt-processor-challenge/store"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
+// A router whose responses fail the test when they do not match the spec
+func newTestRouter(t *testing.T, cfg Config) http.Handler {
+	document, err := spec.Load("../api.yml")
+	if err != nil {
+		t.Fatalf("Error loading spec: %v", err)
+	}
+	return spectest.Handler(t, document, SetUpRouter(cfg))
+}
+
 func TestSetupRouter(t *testing.T) {
-	test_router := SetUpRouter()
+	test_router := SetUpRouter(Config{Receipts: store.NewMemoryStore()})
 	assert.NotNil(t, test_router, "Router should not be nil")
 }
 
 func TestSetupLogger(t *testing.T) {
-	test_logger := SetUpRouter()
+	test_logger := SetUpRouter(Config{Receipts: store.NewMemoryStore()})
 	assert.NotNil(t, test_logger, "Logger should not be nil")
 }
+
+func TestSetupRouter_RateLimits(t *testing.T) {
+	limits := middleware.RateLimitConfig{RateLimits: middleware.RateLimits{
+		Default: middleware.RateLimit{Rate: 1, Burst: 1},
+	}}
+	test_router := newTestRouter(t, Config{RateLimits: &limits})
+
+	send := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		test_router.ServeHTTP(w, httptest.NewRequest("GET", "/receipts", nil))
+		return w
+	}
+	first := send()
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.NotEmpty(t, first.Header().Get("X-Request-ID"), "Middleware should apply to the routes")
+	assert.Equal(t, http.StatusTooManyRequests, send().Code, "The rate limit should apply to the routes")
+}
+
+// Requests with invalid keys are limited by address before authentication
+func TestSetupRouter_RateLimitsBeforeAuth(t *testing.T) {
+	auth, err := middleware.NewAuthenticator([]middleware.APIKey{
+		{Name: "reporting", Hash: middleware.HashAPIKey("read-key"), Scopes: []string{middleware.ScopeRead}},
+	})
+	assert.NoError(t, err)
+	limits := middleware.RateLimitConfig{
+		RateLimits: middleware.RateLimits{Default: middleware.RateLimit{Rate: 1, Burst: 5}},
+		PerIP:      middleware.RateLimit{Rate: 1, Burst: 1},
+	}
+	test_router := newTestRouter(t, Config{Auth: auth, RateLimits: &limits})
+
+	send := func(authorization string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/receipts", nil)
+		req.Header.Set("Authorization", authorization)
+		test_router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, send("ApiKey guess"))
+	assert.Equal(t, http.StatusTooManyRequests, send("ApiKey guess"), "Invalid keys should be rate limited")
+}
+
+func TestSetupRouter_Scopes(t *testing.T) {
+	auth, err := middleware.NewAuthenticator([]middleware.APIKey{
+		{Name: "reporting", Hash: middleware.HashAPIKey("read-key"), Scopes: []string{middleware.ScopeRead}},
+	})
+	assert.NoError(t, err)
+	test_router := newTestRouter(t, Config{Auth: auth})
+
+	send := func(method string, path string, authorization string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		test_router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, send("GET", "/receipts", ""))
+	assert.Equal(t, http.StatusOK, send("GET", "/receipts", "ApiKey read-key"))
+	assert.Equal(t, http.StatusForbidden, send("POST", "/receipts/process", "ApiKey read-key"))
+	assert.Equal(t, http.StatusForbidden, send("DELETE", "/receipts/a", "ApiKey read-key"))
+}
+
+func TestSetupRouter_ValidatesRequests(t *testing.T) {
+	document, err := spec.Load("../api.yml")
+	assert.NoError(t, err)
+	test_router := newTestRouter(t, Config{Receipts: store.NewMemoryStore(), Spec: document})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(`{"retailer": "Target"}`))
+	req.Header.Set("Content-Type", "application/json")
+	test_router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `{"in":"body","name":"","message":"missing properties 'purchaseDate', 'purchaseTime', 'items', 'total'"}`)
+
+	w = httptest.NewRecorder()
+	test_router.ServeHTTP(w, httptest.NewRequest("POST", "/receipts/process", strings.NewReader(`{
+		"retailer": "Target",
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}],
+		"total": "6.49"
+	}`)))
+	assert.Equal(t, http.StatusOK, w.Code, "A body without a Content-Type should be taken as JSON")
+
+	w = httptest.NewRecorder()
+	test_router.ServeHTTP(w, httptest.NewRequest("GET", "/receipts?limit=0", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Validation should apply to the routes")
+}
+
+func TestSetupRouter_ValidatesBatchReceipts(t *testing.T) {
+	document, err := spec.Load("../api.yml")
+	assert.NoError(t, err)
+	test_router := newTestRouter(t, Config{Receipts: store.NewMemoryStore(), Spec: document})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/receipts/batch", strings.NewReader(`{"receipts": [{"retailer": "Target"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	test_router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code, "Receipts of a batch should match the Receipt schema")
+	assert.Contains(t, w.Body.String(), `{"in":"body","name":"/receipts/0","message":"missing properties 'purchaseDate', 'purchaseTime', 'items', 'total'"}`)
+}
+
+func TestSetupRouter_ValidatesResponses(t *testing.T) {
+	document, err := spec.Load("../api.yml")
+	assert.NoError(t, err)
+	core, logs := observer.New(zap.WarnLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+	test_router := SetUpRouter(Config{Receipts: store.NewMemoryStore(), Spec: document, ValidateResponses: true})
+
+	w := httptest.NewRecorder()
+	test_router.ServeHTTP(w, httptest.NewRequest("GET", "/receipts/00000000-0000-0000-0000-000000000000", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Zero(t, logs.FilterMessageSnippet("does not match the spec").Len(), "Declared responses should not be logged")
+}
+
+func TestSetupRouter_ServesSpec(t *testing.T) {
+	document, err := spec.Load("../api.yml")
+	assert.NoError(t, err)
+	auth, err := middleware.NewAuthenticator(nil)
+	assert.NoError(t, err)
+	test_router := SetUpRouter(Config{Spec: document, ServerURL: "http://localhost:8080", Auth: auth})
+
+	for _, path := range []string{"/openapi.yaml", "/openapi.json", "/docs", "/docs/assets/docs.js"} {
+		w := httptest.NewRecorder()
+		test_router.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		assert.Equal(t, http.StatusOK, w.Code, "%s should be public", path)
+	}
+
+	w := httptest.NewRecorder()
+	test_router.ServeHTTP(w, httptest.NewRequest("GET", "/receipts", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,59 @@
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+)
+
+// Checks a response to r against those the operation of the route declares:
+// the status, the Content-Type and a JSON body. Responses of routes the
+// document does not describe are not checked.
+func (s *Spec) ValidateResponse(r *http.Request, route string, status int, header http.Header, body []byte) *ValidationError {
+	item, op := s.operation(r.Method, route)
+	if op == nil {
+		return nil
+	}
+	failed := func(violations ...Violation) *ValidationError {
+		return &ValidationError{Status: http.StatusInternalServerError, Violations: violations}
+	}
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err == nil && !isJSON(mediaType) {
+		if violations := streamedResponse(op, status, mediaType); len(violations) > 0 {
+			return failed(violations...)
+		}
+		return nil
+	}
+
+	response := &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(bytes.NewReader(body))}
+	if _, errs := s.responses.ValidateResponseBodyWithPathItem(r, response, item, route); len(errs) > 0 {
+		return failed(violations(errs)...)
+	}
+	return nil
+}
+
+// Streamed bodies such as NDJSON hold many JSON documents the validator would
+// read as one, so only their status and media type are checked
+func streamedResponse(op *v3.Operation, status int, mediaType string) []Violation {
+	declared := op.Responses.FindResponseByCode(status)
+	if declared == nil {
+		declared = op.Responses.Codes.GetOrZero(fmt.Sprintf("%dXX", status/100))
+	}
+	if declared == nil {
+		declared = op.Responses.Default
+	}
+	if declared == nil {
+		return []Violation{{In: "status", Message: fmt.Sprintf("response code '%d' does not exist", status)}}
+	}
+	if declared.Content == nil {
+		return []Violation{{In: "body", Message: fmt.Sprintf("is not declared for status %d", status)}}
+	}
+	if _, ok := declared.Content.Get(mediaType); !ok {
+		return []Violation{{In: "header", Name: "Content-Type", Message: fmt.Sprintf("response content type '%s' does not exist", mediaType)}}
+	}
+	return nil
+}
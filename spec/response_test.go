@@ -0,0 +1,58 @@
+package spec
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateResponse(t *testing.T) {
+	s := loadTestSpec(t)
+	json := http.Header{"Content-Type": []string{"application/json; charset=utf-8"}}
+	tests := map[string]struct {
+		method string
+		route  string
+		status int
+		header http.Header
+		body   string
+		err    string
+	}{
+		"valid":              {"POST", "/receipts/process", 200, json, `{"id": "a"}`, ""},
+		"missing property":   {"POST", "/receipts/process", 200, json, `{}`, "body: missing property 'id'"},
+		"undeclared fields":  {"GET", "/receipts/{id}", 404, json, `{"code": "error", "message": "x"}`, "body: missing property 'error'"},
+		"undeclared status":  {"GET", "/receipts/{id}", 418, json, `{}`, "GET operation request response code '418' does not exist"},
+		"wrong content type": {"GET", "/receipts/{id}", 404, http.Header{"Content-Type": []string{"text/plain"}}, "x", "response content type 'text/plain' does not exist"},
+		"no content":         {"DELETE", "/receipts/{id}", 204, http.Header{}, "", ""},
+		"streamed body":      {"POST", "/receipts/stream", 200, http.Header{"Content-Type": []string{"application/x-ndjson"}}, "{}\n{}\n", ""},
+		"streamed status":    {"POST", "/receipts/stream", 418, http.Header{"Content-Type": []string{"application/x-ndjson"}}, "{}\n", "response code '418' does not exist"},
+		"undescribed route":  {"GET", "/unknown", 200, json, `{}`, ""},
+	}
+	for name, test := range tests {
+		req := httptest.NewRequest(test.method, strings.Replace(test.route, "{id}", "a", 1), nil)
+		err := s.ValidateResponse(req, test.route, test.status, test.header, []byte(test.body))
+		if test.err == "" {
+			assert.Nil(t, err, name)
+		} else if assert.NotNil(t, err, name) {
+			assert.Equal(t, test.err, err.Error(), name)
+		}
+	}
+}
+
+func TestMatchRoute(t *testing.T) {
+	s := loadTestSpec(t)
+	route, ok := s.MatchRoute(httptest.NewRequest("GET", "/receipts/abc/points", nil))
+	assert.True(t, ok)
+	assert.Equal(t, "/receipts/{id}/points", route)
+
+	route, ok = s.MatchRoute(httptest.NewRequest("POST", "/receipts/process", nil))
+	assert.True(t, ok)
+	assert.Equal(t, "/receipts/process", route, "Fixed paths should win over templates")
+
+	_, ok = s.MatchRoute(httptest.NewRequest("GET", "/receipts/abc/unknown", nil))
+	assert.False(t, ok)
+	_, ok = s.MatchRoute(httptest.NewRequest("TRACE", "/receipts", nil))
+	assert.False(t, ok, "Undescribed methods should not match")
+}
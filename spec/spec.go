@@ -18,9 +18,17 @@ func loadSpec(specFile string) (*libopenapi.DocumentModel[v3.Document], error) {
 		return nil, fmt.Errorf("error reading file: %e", err)
 	}
 
+	docModel, err := parseSpec(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed creating spec from %s: %w", specFile, err)
+	}
+	return docModel, nil
+}
+
+func parseSpec(spec []byte) (*libopenapi.DocumentModel[v3.Document], error) {
 	specDocument, err := libopenapi.NewDocument(spec)
 	if err != nil {
-		return nil, fmt.Errorf("failed creating spec from %s: %e", specFile, err)
+		return nil, err
 	}
 
 	docModel, errors := specDocument.BuildV3Model()
@@ -44,3 +52,17 @@ func PrintSpec(specFile string) error {
 	fmt.Printf("\n%s %s - %s\n\n", spec.Model.Info.Title, spec.Model.Info.Version, spec.Model.Info.Description)
 	return nil
 }
+
+// Renders the document as YAML and JSON with serverURL as its only server.
+// The loaded document is left as it is.
+func (s *Spec) Render(serverURL string) (yamlDocument []byte, jsonDocument []byte, err error) {
+	model := s.Document.Model
+	model.Servers = []*v3.Server{{URL: serverURL}}
+	if yamlDocument, err = model.Render(); err != nil {
+		return nil, nil, fmt.Errorf("error rendering spec as YAML: %w", err)
+	}
+	if jsonDocument, err = model.RenderJSON("  "); err != nil {
+		return nil, nil, fmt.Errorf("error rendering spec as JSON: %w", err)
+	}
+	return yamlDocument, jsonDocument, nil
+}
@@ -1,6 +1,7 @@
 package spec
 
 import (
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -45,3 +46,21 @@ func TestPrintSpecInvalid(t *testing.T) {
 	err := PrintSpec("NoExist.yml")
 	assert.Error(t, err, "Error loading spec")
 }
+
+func TestRender(t *testing.T) {
+	s, err := Load("../api.yml")
+	assert.NoError(t, err, "Error loading spec")
+
+	yamlDocument, jsonDocument, err := s.Render("http://example.com:9090")
+	assert.NoError(t, err, "Error rendering spec")
+	assert.Nil(t, s.Document.Model.Servers, "The loaded document should not change")
+	for _, rendered := range [][]byte{yamlDocument, jsonDocument} {
+		document, err := Parse(rendered)
+		if assert.NoError(t, err, "The rendered spec should load") {
+			assert.Equal(t, "http://example.com:9090", document.Document.Model.Servers[0].URL)
+			assert.Equal(t, s.Document.Model.Info.Title, document.Document.Model.Info.Title)
+			_, ok := document.MatchRoute(httptest.NewRequest("GET", "/receipts/a/points", nil))
+			assert.True(t, ok, "The rendered spec should keep the paths")
+		}
+	}
+}
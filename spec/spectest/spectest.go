@@ -0,0 +1,44 @@
+// Package spectest checks in tests that the responses of a handler match the
+// OpenAPI document
+package spectest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jiyo4476/receipt-processor-challenge/spec"
+)
+
+// Wraps next so every response it writes is checked against the document, and
+// t fails for each one that does not match. Responses are buffered, so the
+// wrapped handler cannot stream.
+func Handler(t testing.TB, document *spec.Spec, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := httptest.NewRecorder()
+		next.ServeHTTP(recorder, r)
+		AssertResponse(t, document, r, recorder)
+
+		for name, values := range recorder.Header() {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(recorder.Code)
+		_, _ = w.Write(recorder.Body.Bytes())
+	})
+}
+
+// Fails t when the recorded response to r does not match the operation the
+// document gives for it. Requests to paths the document does not describe are
+// not checked.
+func AssertResponse(t testing.TB, document *spec.Spec, r *http.Request, w *httptest.ResponseRecorder) bool {
+	t.Helper()
+	route, ok := document.MatchRoute(r)
+	if !ok {
+		return true
+	}
+	if err := document.ValidateResponse(r, route, w.Code, w.Header(), w.Body.Bytes()); err != nil {
+		t.Errorf("Response %d to %s %s does not match %s: %v", w.Code, r.Method, r.URL.Path, route, err)
+		return false
+	}
+	return true
+}
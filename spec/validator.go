@@ -0,0 +1,234 @@
+package spec
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pb33f/libopenapi"
+	validation "github.com/pb33f/libopenapi-validator/errors"
+	"github.com/pb33f/libopenapi-validator/helpers"
+	"github.com/pb33f/libopenapi-validator/parameters"
+	"github.com/pb33f/libopenapi-validator/paths"
+	"github.com/pb33f/libopenapi-validator/requests"
+	"github.com/pb33f/libopenapi-validator/responses"
+	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+// Spec is a loaded OpenAPI document with the validators that check requests
+// and responses against it
+type Spec struct {
+	Document   *libopenapi.DocumentModel[v3.Document]
+	parameters parameters.ParameterValidator
+	bodies     requests.RequestBodyValidator
+	responses  responses.ResponseBodyValidator
+}
+
+// Violation is one way a request or response does not match the document
+type Violation struct {
+	// Where the problem is, path, query, header, cookie, body or status
+	In string `json:"in"`
+	// The JSON pointer of the value in the body, or Content-Type for an
+	// unaccepted media type
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// Messages of parameters, headers and statuses name what they are about,
+// those of the body are named by their JSON pointer
+func (v Violation) String() string {
+	if v.In != "body" {
+		return v.Message
+	}
+	if v.Name == "" {
+		return "body: " + v.Message
+	}
+	return fmt.Sprintf("body %s: %s", v.Name, v.Message)
+}
+
+// ValidationError lists the violations of a request and the status to
+// answer it with
+type ValidationError struct {
+	Status     int
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.String()
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Loads the OpenAPI document in specFile
+func Load(specFile string) (*Spec, error) {
+	document, err := loadSpec(specFile)
+	if err != nil {
+		return nil, err
+	}
+	return newSpec(document), nil
+}
+
+// Parses an OpenAPI document
+func Parse(data []byte) (*Spec, error) {
+	document, err := parseSpec(data)
+	if err != nil {
+		return nil, err
+	}
+	return newSpec(document), nil
+}
+
+func newSpec(document *libopenapi.DocumentModel[v3.Document]) *Spec {
+	return &Spec{
+		Document:   document,
+		parameters: parameters.NewParameterValidator(&document.Model),
+		bodies:     requests.NewRequestBodyValidator(&document.Model),
+		responses:  responses.NewResponseBodyValidator(&document.Model),
+	}
+}
+
+// The path item of route, a path template of the document such as
+// /receipts/{id}, and its operation for method. Both are nil when the
+// document does not describe them.
+func (s *Spec) operation(method string, route string) (*v3.PathItem, *v3.Operation) {
+	if s.Document.Model.Paths == nil {
+		return nil, nil
+	}
+	item := s.Document.Model.Paths.PathItems.GetOrZero(route)
+	if item == nil {
+		return nil, nil
+	}
+	op := item.GetOperations().GetOrZero(strings.ToLower(method))
+	if op == nil {
+		return nil, nil
+	}
+	return item, op
+}
+
+// Checks the parameters and body of the request against the operation of the
+// route. Requests to routes the document does not describe are not checked. A
+// body sent without a Content-Type is given the operation's media type when
+// it accepts only one, JSON, type. JSON bodies are read to check them and put
+// back for the handler, other bodies are left unread.
+func (s *Spec) ValidateRequest(r *http.Request, route string) *ValidationError {
+	item, op := s.operation(r.Method, route)
+	if op == nil {
+		return nil
+	}
+	var found []*validation.ValidationError
+	for _, validate := range []func(*http.Request, *v3.PathItem, string) (bool, []*validation.ValidationError){
+		s.parameters.ValidatePathParamsWithPathItem,
+		s.parameters.ValidateQueryParamsWithPathItem,
+		s.parameters.ValidateHeaderParamsWithPathItem,
+		s.parameters.ValidateCookieParamsWithPathItem,
+	} {
+		_, errs := validate(r, item, route)
+		found = append(found, errs...)
+	}
+
+	if body := op.RequestBody; body != nil {
+		defaultContentType(r, body)
+		if !streamed(r, body) {
+			_, errs := s.bodies.ValidateRequestBodyWithPathItem(r, item, route)
+			for _, err := range errs {
+				if err.ValidationSubType == helpers.RequestBodyContentType {
+					return &ValidationError{
+						Status:     http.StatusUnsupportedMediaType,
+						Violations: violations([]*validation.ValidationError{err}),
+					}
+				}
+			}
+			found = append(found, errs...)
+		}
+	}
+	if len(found) > 0 {
+		return &ValidationError{Status: http.StatusBadRequest, Violations: violations(found)}
+	}
+	return nil
+}
+
+// Finds the path template of the document that the request matches
+func (s *Spec) MatchRoute(r *http.Request) (string, bool) {
+	item, errs, route := paths.FindPath(r, &s.Document.Model)
+	return route, item != nil && len(errs) == 0
+}
+
+func defaultContentType(r *http.Request, body *v3.RequestBody) {
+	if r.Header.Get("Content-Type") != "" || body.Content == nil || body.Content.Len() != 1 {
+		return
+	}
+	required := body.Required != nil && *body.Required
+	if !required && (r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0) {
+		return
+	}
+	if mediaType := body.Content.First().Key(); isJSON(mediaType) {
+		r.Header.Set("Content-Type", mediaType)
+	}
+}
+
+// Reports whether the body has a declared media type other than JSON. Such
+// bodies, NDJSON and CSV, are streamed to the handler, which checks them as it
+// reads them.
+func streamed(r *http.Request, body *v3.RequestBody) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || isJSON(mediaType) || body.Content == nil {
+		return false
+	}
+	_, declared := body.Content.Get(mediaType)
+	return declared
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// Lists the errors of the validator as violations, one for each value of the
+// body that does not match its schema
+func violations(errs []*validation.ValidationError) []Violation {
+	var found []Violation
+	for _, err := range errs {
+		in := "body"
+		switch {
+		case err.ValidationSubType == helpers.RequestBodyContentType:
+			found = append(found, Violation{In: "header", Name: "Content-Type", Message: err.Message})
+			continue
+		case err.ValidationSubType == helpers.ResponseBodyResponseCode:
+			found = append(found, Violation{In: "status", Message: err.Message})
+			continue
+		case err.ValidationType == helpers.ParameterValidation:
+			in = err.ValidationSubType
+		}
+		if len(err.SchemaValidationErrors) == 0 {
+			found = append(found, Violation{In: in, Message: err.Message})
+			continue
+		}
+		instances := instanceLocations(err.SchemaValidationErrors[0].OriginalError)
+		for _, failure := range err.SchemaValidationErrors {
+			switch {
+			case in != "body":
+				found = append(found, Violation{In: in, Message: err.Message + ": " + failure.Reason})
+			case failure.OriginalError == nil:
+				// The body is missing or is not JSON
+				found = append(found, Violation{In: in, Message: err.Reason})
+			default:
+				found = append(found, Violation{In: in, Name: instances[failure.Location], Message: failure.Reason})
+			}
+		}
+	}
+	return found
+}
+
+// The JSON pointer of the value each failed keyword of the schema checked
+func instanceLocations(err *jsonschema.ValidationError) map[string]string {
+	locations := map[string]string{}
+	if err == nil {
+		return locations
+	}
+	for _, unit := range err.BasicOutput().Errors {
+		locations[unit.KeywordLocation] = unit.InstanceLocation
+	}
+	return locations
+}
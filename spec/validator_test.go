@@ -0,0 +1,161 @@
+package spec
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const validReceipt = `{
+	"retailer": "Target",
+	"purchaseDate": "2022-01-01",
+	"purchaseTime": "13:01",
+	"items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.49"}],
+	"total": "6.49"
+}`
+
+func loadTestSpec(t *testing.T) *Spec {
+	s, err := Load("../api.yml")
+	assert.NoError(t, err, "Error loading spec")
+	return s
+}
+
+func newJSONRequest(method string, url string, body string) *http.Request {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+func TestLoadInvalid(t *testing.T) {
+	_, err := Load("noExist.yml")
+	assert.Error(t, err, "Expected Error loading spec")
+}
+
+func TestValidateRequest_ValidReceipt(t *testing.T) {
+	s := loadTestSpec(t)
+	req := newJSONRequest("POST", "/receipts/process", validReceipt)
+	assert.Nil(t, s.ValidateRequest(req, "/receipts/process"))
+
+	body, err := io.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.JSONEq(t, validReceipt, string(body), "The body should be put back for the handler")
+}
+
+func TestValidateRequest_Body(t *testing.T) {
+	s := loadTestSpec(t)
+	body := `{
+		"purchaseDate": "2022-01-01",
+		"purchaseTime": "13:01",
+		"items": [{"shortDescription": "Mountain Dew 12PK", "price": "6.4"}],
+		"total": 6.49
+	}`
+	err := s.ValidateRequest(newJSONRequest("POST", "/receipts/process", body), "/receipts/process")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.Status)
+		names := map[string]string{}
+		for _, violation := range err.Violations {
+			assert.Equal(t, "body", violation.In)
+			names[violation.Name] = violation.Message
+		}
+		assert.Equal(t, "missing property 'retailer'", names[""])
+		assert.Contains(t, names["/items/0/price"], "does not match pattern")
+		assert.Equal(t, "got number, want string", names["/total"])
+	}
+
+	err = s.ValidateRequest(newJSONRequest("POST", "/receipts/process", `{"retailer": `), "/receipts/process")
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "cannot be decoded")
+	}
+	err = s.ValidateRequest(newJSONRequest("POST", "/receipts/process", ""), "/receipts/process")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, "body: The request body is empty but there is a schema defined", err.Error())
+	}
+}
+
+func TestValidateRequest_Parameters(t *testing.T) {
+	s := loadTestSpec(t)
+	tests := map[string]struct {
+		url     string
+		message string
+	}{
+		"limit too small":   {"/receipts?limit=0", "Query parameter 'limit' failed to validate: minimum: got 0, want 1"},
+		"limit too large":   {"/receipts?limit=101", "Query parameter 'limit' failed to validate: maximum: got 101, want 100"},
+		"limit not integer": {"/receipts?limit=ten", "Query parameter 'limit' is not a valid number"},
+		"valid limit":       {"/receipts?limit=100", ""},
+	}
+	for name, test := range tests {
+		err := s.ValidateRequest(httptest.NewRequest("GET", test.url, nil), "/receipts")
+		if test.message == "" {
+			assert.Nil(t, err, name)
+		} else if assert.NotNil(t, err, name) {
+			assert.Equal(t, test.message, err.Error(), name)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/receipts/a%20b/points?ruleVersion=latest", nil)
+	err := s.ValidateRequest(req, "/receipts/{id}/points")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, []Violation{
+			{In: "path", Message: `Path parameter 'id' failed to validate: 'a b' does not match pattern '^\\S+$'`},
+			{In: "query", Message: "Query parameter 'ruleVersion' is not a valid number"},
+		}, err.Violations)
+	}
+}
+
+func TestValidateRequest_ContentType(t *testing.T) {
+	s := loadTestSpec(t)
+	req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(validReceipt))
+	req.Header.Set("Content-Type", "text/plain")
+	err := s.ValidateRequest(req, "/receipts/process")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusUnsupportedMediaType, err.Status)
+		assert.Equal(t, []Violation{{
+			In: "header", Name: "Content-Type", Message: "POST operation request content type 'text/plain' does not exist",
+		}}, err.Violations)
+	}
+
+	req = newJSONRequest("PATCH", "/receipts/a", `{"retailer": "Walmart"}`)
+	req.Header.Set("Content-Type", "application/merge-patch+json; charset=utf-8")
+	assert.Nil(t, s.ValidateRequest(req, "/receipts/{id}"), "Parameters of the media type should be ignored")
+}
+
+func TestValidateRequest_DefaultContentType(t *testing.T) {
+	s := loadTestSpec(t)
+	req := httptest.NewRequest("POST", "/receipts/process", strings.NewReader(validReceipt))
+	assert.Nil(t, s.ValidateRequest(req, "/receipts/process"))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"), "A missing Content-Type should default to the only JSON media type")
+
+	req = httptest.NewRequest("POST", "/receipts/process", strings.NewReader(`{}`))
+	err := s.ValidateRequest(req, "/receipts/process")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusBadRequest, err.Status, "The defaulted body should be checked")
+	}
+
+	req = httptest.NewRequest("POST", "/receipts/stream", strings.NewReader("{}\n"))
+	err = s.ValidateRequest(req, "/receipts/stream")
+	if assert.NotNil(t, err) {
+		assert.Equal(t, http.StatusUnsupportedMediaType, err.Status, "Only JSON media types should be defaulted")
+	}
+}
+
+func TestValidateRequest_StreamedBody(t *testing.T) {
+	s := loadTestSpec(t)
+	body := "not json\n"
+	req := httptest.NewRequest("POST", "/receipts/stream", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	assert.Nil(t, s.ValidateRequest(req, "/receipts/stream"))
+
+	read, err := io.ReadAll(req.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(read), "Streamed bodies should be left to the handler")
+}
+
+func TestValidateRequest_UnknownRoute(t *testing.T) {
+	s := loadTestSpec(t)
+	assert.Nil(t, s.ValidateRequest(httptest.NewRequest("GET", "/unknown", nil), "/unknown"))
+	assert.Nil(t, s.ValidateRequest(httptest.NewRequest("TRACE", "/receipts", nil), "/receipts"))
+}
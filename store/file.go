@@ -0,0 +1,413 @@
+package store
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+
+	// Each log record starts with the payload length and its CRC-32 checksum
+	walHeaderSize = 8
+	// Guards against allocating huge buffers for a corrupt length field
+	maxWalRecordSize = 16 << 20
+
+	walOpPut    = "put"
+	walOpPutAll = "putAll"
+	walOpDelete = "delete"
+)
+
+// Records embed the receipt fields, so logs written when only receipts were
+// stored decode as records without rule version or points
+type walEntry struct {
+	Op     string  `json:"op"`
+	ID     string  `json:"id"`
+	Record *Record `json:"receipt,omitempty"`
+	// Written by PutAll, the records are applied together
+	Records map[string]Record `json:"receipts,omitempty"`
+}
+
+// FileStore persists receipts to a write-ahead log in dir and serves reads
+// from memory. Every accepted write is appended to the log and synced before it
+// becomes visible; snapshots of the full data set are written periodically and
+// the log is truncated afterwards. Opening the store replays the latest
+// snapshot followed by the log.
+type FileStore struct {
+	dir    string
+	memory *MemoryStore
+
+	// Serializes log appends with snapshots so a snapshot never misses a write
+	mu  sync.Mutex
+	wal *os.File
+	// Set when a failed append could not be cut off, the log then refuses
+	// further writes because replay would stop at the torn record
+	failed error
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Opens or creates a file store in dir. A snapshot is taken every
+// snapshotInterval, a zero interval disables periodic snapshots.
+func OpenFileStore(dir string, snapshotInterval time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating data directory %s: %w", dir, err)
+	}
+
+	s := &FileStore{
+		dir:    dir,
+		memory: NewMemoryStore(),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening write-ahead log: %w", err)
+	}
+	if err := s.replay(wal); err != nil {
+		wal.Close()
+		return nil, err
+	}
+	s.wal = wal
+
+	if snapshotInterval > 0 {
+		go s.snapshotLoop(snapshotInterval)
+	} else {
+		close(s.done)
+	}
+	return s, nil
+}
+
+func (s *FileStore) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading snapshot: %w", err)
+	}
+
+	var records map[string]Record
+	if err := json.Unmarshal(data, &records); err != nil {
+		return fmt.Errorf("error decoding snapshot: %w", err)
+	}
+	ctx := context.Background()
+	for id, record := range records {
+		s.memory.Put(ctx, id, record)
+	}
+	return nil
+}
+
+// Applies every intact log record on top of the snapshot. Reading stops at the
+// first torn or corrupt record, which is cut off so new records are appended
+// after the last good one.
+func (s *FileStore) replay(wal *os.File) error {
+	ctx := context.Background()
+	reader := bufio.NewReader(wal)
+	offset := int64(0)
+	applied := 0
+	for {
+		entry, size, err := readWalEntry(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			zap.L().Warn(fmt.Sprintf("Discarding write-ahead log after offset %d: %v", offset, err))
+			break
+		}
+		switch entry.Op {
+		case walOpPut:
+			if entry.Record != nil {
+				s.memory.Put(ctx, entry.ID, *entry.Record)
+			}
+		case walOpPutAll:
+			s.memory.PutAll(ctx, entry.Records)
+		case walOpDelete:
+			s.memory.Delete(ctx, entry.ID)
+		}
+		offset += size
+		applied++
+	}
+
+	if err := wal.Truncate(offset); err != nil {
+		return fmt.Errorf("error truncating write-ahead log: %w", err)
+	}
+	if _, err := wal.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking write-ahead log: %w", err)
+	}
+	zap.L().Info(fmt.Sprintf("Replayed %d write-ahead log records from %s", applied, s.dir))
+	return nil
+}
+
+func readWalEntry(r io.Reader) (walEntry, int64, error) {
+	var entry walEntry
+	header := make([]byte, walHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return entry, 0, io.EOF
+	}
+	if err != nil {
+		return entry, 0, fmt.Errorf("torn record header (%d bytes)", n)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if length > maxWalRecordSize {
+		return entry, 0, fmt.Errorf("record length %d exceeds limit", length)
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return entry, 0, fmt.Errorf("torn record payload")
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return entry, 0, fmt.Errorf("record checksum mismatch")
+	}
+	if err := json.Unmarshal(payload, &entry); err != nil {
+		return entry, 0, fmt.Errorf("error decoding record: %w", err)
+	}
+	return entry, int64(walHeaderSize + len(payload)), nil
+}
+
+// Must be called with s.mu held
+func (s *FileStore) appendWal(entry walEntry) error {
+	if s.wal == nil {
+		return errors.New("file store is closed")
+	}
+	if s.failed != nil {
+		return s.failed
+	}
+	payload, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	// Replay would stop at a record it refuses to read
+	if len(payload) > maxWalRecordSize {
+		return fmt.Errorf("write-ahead log record of %d bytes exceeds limit", len(payload))
+	}
+	record := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[walHeaderSize:], payload)
+
+	offset, err := s.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("error seeking write-ahead log: %w", err)
+	}
+	if _, err := s.wal.Write(record); err != nil {
+		return s.discardAppend(offset, fmt.Errorf("error appending to write-ahead log: %w", err))
+	}
+	if err := s.wal.Sync(); err != nil {
+		return s.discardAppend(offset, fmt.Errorf("error syncing write-ahead log: %w", err))
+	}
+	return nil
+}
+
+// Cuts a failed append off the log so later records are not written after a
+// torn one. The write was never acknowledged, so dropping it loses nothing.
+// Must be called with s.mu held.
+func (s *FileStore) discardAppend(offset int64, cause error) error {
+	err := s.wal.Truncate(offset)
+	if err == nil {
+		_, err = s.wal.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		s.failed = fmt.Errorf("write-ahead log is unusable after a failed append: %w", cause)
+		zap.L().Error(fmt.Sprintf("Error discarding failed write-ahead log append: %v", err))
+	}
+	return cause
+}
+
+func (s *FileStore) Put(ctx context.Context, id string, record Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.appendWal(walEntry{Op: walOpPut, ID: id, Record: &record}); err != nil {
+		return err
+	}
+	return s.memory.Put(ctx, id, record)
+}
+
+// The records are appended as one log record, so a crash keeps all or none
+func (s *FileStore) PutAll(ctx context.Context, records map[string]Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.appendWal(walEntry{Op: walOpPutAll, Records: records}); err != nil {
+		return err
+	}
+	return s.memory.PutAll(ctx, records)
+}
+
+func (s *FileStore) Get(ctx context.Context, id string) (Record, error) {
+	return s.memory.Get(ctx, id)
+}
+
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.memory.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := s.appendWal(walEntry{Op: walOpDelete, ID: id}); err != nil {
+		return err
+	}
+	return s.memory.Delete(ctx, id)
+}
+
+func (s *FileStore) List(ctx context.Context) ([]string, error) {
+	return s.memory.List(ctx)
+}
+
+func (s *FileStore) Count(ctx context.Context) (int, error) {
+	return s.memory.Count(ctx)
+}
+
+func (s *FileStore) FindByFingerprint(ctx context.Context, fingerprint string) (string, error) {
+	return s.memory.FindByFingerprint(ctx, fingerprint)
+}
+
+func (s *FileStore) Query(ctx context.Context, query ReceiptQuery) ([]Match, error) {
+	return s.memory.Query(ctx, query)
+}
+
+// Writes every stored receipt to a new snapshot and empties the log
+func (s *FileStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+// Must be called with s.mu held
+func (s *FileStore) snapshot() error {
+	if s.wal == nil {
+		return errors.New("file store is closed")
+	}
+	ctx := context.Background()
+	ids, err := s.memory.List(ctx)
+	if err != nil {
+		return err
+	}
+	records := make(map[string]Record, len(ids))
+	for _, id := range ids {
+		if record, err := s.memory.Get(ctx, id); err == nil {
+			records[id] = record
+		}
+	}
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a crash never leaves a partial snapshot
+	tmp := filepath.Join(s.dir, snapshotFileName+".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("error replacing snapshot: %w", err)
+	}
+	// The rename must be durable before the log it replaces is emptied
+	if err := syncDir(s.dir); err != nil {
+		return fmt.Errorf("error syncing data directory: %w", err)
+	}
+
+	if err := s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("error truncating write-ahead log: %w", err)
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("error seeking write-ahead log: %w", err)
+	}
+	// The snapshot holds every logged write, so a log that was left unusable
+	// can start over
+	s.failed = nil
+	zap.L().Info(fmt.Sprintf("Wrote snapshot of %d receipts to %s", len(records), s.dir))
+	return nil
+}
+
+func writeFileSync(name string, data []byte) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return err
+	}
+	return d.Close()
+}
+
+func (s *FileStore) snapshotLoop(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil {
+				zap.L().Error(fmt.Sprintf("Error taking snapshot: %v", err))
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Stops periodic snapshots, writes a final snapshot and closes the log
+func (s *FileStore) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		err = s.snapshot()
+		if closeErr := s.wal.Close(); err == nil {
+			err = closeErr
+		}
+		s.wal = nil
+	})
+	return err
+}
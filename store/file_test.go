@@ -0,0 +1,224 @@
+package store
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestFileStore(t *testing.T, dir string) *FileStore {
+	s, err := OpenFileStore(dir, 0)
+	if err != nil {
+		t.Fatalf("Error opening file store: %v", err)
+	}
+	return s
+}
+
+// Simulates a crash by dropping the store without a final snapshot
+func crash(s *FileStore) {
+	s.wal.Close()
+}
+
+func TestFileStore_ReplaysLogAfterCrash(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := openTestFileStore(t, dir)
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Target")))
+	assert.NoError(t, s.Put(ctx, "b", createTestRecord("Walgreens")))
+	assert.NoError(t, s.Delete(ctx, "a"))
+	crash(s)
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	_, err := reopened.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotFound)
+	found, err := reopened.Get(ctx, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "Walgreens", found.Retailer)
+}
+
+func TestFileStore_SnapshotAndLog(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := openTestFileStore(t, dir)
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Target")))
+	assert.NoError(t, s.Snapshot())
+
+	info, err := os.Stat(filepath.Join(dir, walFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), info.Size(), "log should be empty after a snapshot")
+
+	assert.NoError(t, s.Put(ctx, "b", createTestRecord("Walgreens")))
+	crash(s)
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	count, err := reopened.Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestFileStore_CloseWritesSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := openTestFileStore(t, dir)
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Target")))
+	assert.NoError(t, s.Close())
+	assert.NoError(t, s.Close(), "closing twice should be a no-op")
+	assert.Error(t, s.Put(ctx, "b", createTestRecord("Target")))
+
+	assert.FileExists(t, filepath.Join(dir, snapshotFileName))
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	_, err := reopened.Get(ctx, "a")
+	assert.NoError(t, err)
+}
+
+func TestFileStore_RecoversFromTruncatedLog(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := openTestFileStore(t, dir)
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Target")))
+	assert.NoError(t, s.Put(ctx, "b", createTestRecord("Walgreens")))
+	assert.NoError(t, s.Put(ctx, "c", createTestRecord("Costco")))
+	crash(s)
+
+	// Cut the last record off in the middle of its payload
+	walPath := filepath.Join(dir, walFileName)
+	info, err := os.Stat(walPath)
+	assert.NoError(t, err)
+	assert.NoError(t, os.Truncate(walPath, info.Size()-10))
+
+	reopened := openTestFileStore(t, dir)
+	ids, err := reopened.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+
+	// New writes must land after the last intact record
+	assert.NoError(t, reopened.Put(ctx, "d", createTestRecord("Target")))
+	crash(reopened)
+
+	again := openTestFileStore(t, dir)
+	defer again.Close()
+	ids, err = again.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "d"}, ids)
+}
+
+// A failed append is cut off so the next record follows the last good one
+func TestFileStore_DiscardsFailedAppend(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := openTestFileStore(t, dir)
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Target")))
+
+	offset, err := s.wal.Seek(0, io.SeekCurrent)
+	assert.NoError(t, err)
+	_, err = s.wal.Write([]byte{0, 0, 1})
+	assert.NoError(t, err)
+	cause := errors.New("short write")
+	assert.ErrorIs(t, s.discardAppend(offset, cause), cause)
+
+	assert.NoError(t, s.Put(ctx, "b", createTestRecord("Walgreens")))
+	crash(s)
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	ids, err := reopened.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+}
+
+// A failed append that cannot be cut off stops writes until a snapshot
+func TestFileStore_FailsWhenAppendCannotBeDiscarded(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := openTestFileStore(t, dir)
+	defer s.Close()
+	wal := s.wal
+	readOnly, err := os.Open(wal.Name())
+	assert.NoError(t, err)
+	s.wal = readOnly
+
+	assert.Error(t, s.Put(ctx, "a", createTestRecord("Target")))
+	s.wal = wal
+	readOnly.Close()
+	assert.Error(t, s.Put(ctx, "b", createTestRecord("Target")), "writes should fail while the log is unusable")
+	_, err = s.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, s.Snapshot())
+	assert.NoError(t, s.Put(ctx, "c", createTestRecord("Target")))
+}
+
+func TestFileStore_RecoversFromTruncatedHeader(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := openTestFileStore(t, dir)
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Target")))
+	crash(s)
+
+	walPath := filepath.Join(dir, walFileName)
+	f, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	f.Write([]byte{0, 0, 1})
+	f.Close()
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	ids, err := reopened.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, ids)
+}
+
+func TestFileStore_IgnoresCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	s := openTestFileStore(t, dir)
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Target")))
+	assert.NoError(t, s.Put(ctx, "b", createTestRecord("Walgreens")))
+	crash(s)
+
+	// Flip a byte in the last record's payload so its checksum no longer matches
+	walPath := filepath.Join(dir, walFileName)
+	data, err := os.ReadFile(walPath)
+	assert.NoError(t, err)
+	data[len(data)-2] ^= 0xff
+	assert.NoError(t, os.WriteFile(walPath, data, 0o644))
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	ids, err := reopened.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, ids)
+}
+
+func TestFileStore_ReadsReceiptOnlyLog(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	// Logs written before records carried points only hold the receipt fields
+	payload := []byte(`{"op":"put","id":"a","receipt":{"retailer":"Target","purchaseDate":"2022-01-01",` +
+		`"purchaseTime":"13:01","items":[{"shortDescription":"Dasani","price":"1.40"}],"total":"1.40"}}`)
+	record := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[walHeaderSize:], payload)
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, walFileName), record, 0o644))
+
+	s := openTestFileStore(t, dir)
+	defer s.Close()
+	found, err := s.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, "Target", found.Retailer)
+	assert.Equal(t, models.MustParseMoney("1.40"), found.Items[0].Price)
+	assert.Equal(t, 0, found.RuleVersion)
+}
@@ -0,0 +1,226 @@
+package store
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// Number of lock stripes, a power of two so a shard can be picked with a mask
+const shardCount = 32
+
+type shard struct {
+	mu       sync.RWMutex
+	receipts map[string]Record
+}
+
+// MemoryStore keeps receipts in memory, data is lost when the process stops.
+// Receipts are spread over independently locked shards so concurrent requests
+// for different ids rarely contend on the same lock.
+type MemoryStore struct {
+	shards [shardCount]*shard
+
+	// Ids of the records with each fingerprint. Always locked after a shard.
+	fingerprintMu sync.Mutex
+	fingerprints  map[string]map[string]struct{}
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{fingerprints: make(map[string]map[string]struct{})}
+	for i := range s.shards {
+		s.shards[i] = &shard{receipts: make(map[string]Record)}
+	}
+	return s
+}
+
+func shardIndex(id string) int {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return int(h.Sum32() & (shardCount - 1))
+}
+
+func (s *MemoryStore) shardFor(id string) *shard {
+	return s.shards[shardIndex(id)]
+}
+
+func (s *MemoryStore) Put(ctx context.Context, id string, record Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	s.put(sh, id, record)
+	return nil
+}
+
+// Takes the lock of every shard involved, in shard order so concurrent calls
+// cannot deadlock, so no reader sees part of the records
+func (s *MemoryStore) PutAll(ctx context.Context, records map[string]Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var involved [shardCount]bool
+	for id := range records {
+		involved[shardIndex(id)] = true
+	}
+	for i, sh := range s.shards {
+		if involved[i] {
+			sh.mu.Lock()
+			defer sh.mu.Unlock()
+		}
+	}
+	for id, record := range records {
+		s.put(s.shardFor(id), id, record)
+	}
+	return nil
+}
+
+// Must be called with the shard's lock held
+func (s *MemoryStore) put(sh *shard, id string, record Record) {
+	old, replaced := sh.receipts[id]
+	sh.receipts[id] = record
+
+	s.fingerprintMu.Lock()
+	defer s.fingerprintMu.Unlock()
+	if replaced {
+		s.unindex(id, old)
+	}
+	if fingerprint := record.indexedFingerprint(); fingerprint != "" {
+		ids, ok := s.fingerprints[fingerprint]
+		if !ok {
+			ids = make(map[string]struct{})
+			s.fingerprints[fingerprint] = ids
+		}
+		ids[id] = struct{}{}
+	}
+}
+
+// Must be called with fingerprintMu held
+func (s *MemoryStore) unindex(id string, record Record) {
+	fingerprint := record.indexedFingerprint()
+	if ids, ok := s.fingerprints[fingerprint]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(s.fingerprints, fingerprint)
+		}
+	}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Record, error) {
+	if err := ctx.Err(); err != nil {
+		return Record{}, err
+	}
+	sh := s.shardFor(id)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	record, ok := sh.receipts[id]
+	if !ok {
+		return Record{}, ErrNotFound
+	}
+	return record, nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	sh := s.shardFor(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	record, ok := sh.receipts[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(sh.receipts, id)
+
+	s.fingerprintMu.Lock()
+	defer s.fingerprintMu.Unlock()
+	s.unindex(id, record)
+	return nil
+}
+
+// List locks one shard at a time, so receipts written while it runs may or
+// may not be included
+func (s *MemoryStore) List(ctx context.Context) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for id := range sh.receipts {
+			ids = append(ids, id)
+		}
+		sh.mu.RUnlock()
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+func (s *MemoryStore) Count(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		count += len(sh.receipts)
+		sh.mu.RUnlock()
+	}
+	return count, nil
+}
+
+func (s *MemoryStore) FindByFingerprint(ctx context.Context, fingerprint string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	s.fingerprintMu.Lock()
+	ids := make([]string, 0, len(s.fingerprints[fingerprint]))
+	for id := range s.fingerprints[fingerprint] {
+		ids = append(ids, id)
+	}
+	s.fingerprintMu.Unlock()
+
+	found, earliest := "", Record{}
+	for _, id := range ids {
+		record, err := s.Get(ctx, id)
+		if err != nil {
+			// Removed since the index was read
+			continue
+		}
+		if found == "" || record.CreatedAt.Before(earliest.CreatedAt) ||
+			record.CreatedAt.Equal(earliest.CreatedAt) && id < found {
+			found, earliest = id, record
+		}
+	}
+	if found == "" {
+		return "", ErrNotFound
+	}
+	return found, nil
+}
+
+// Query reads one shard at a time like List, so receipts written while it runs
+// may or may not be included
+func (s *MemoryStore) Query(ctx context.Context, query ReceiptQuery) ([]Match, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	matches := []Match{}
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		for id, record := range sh.receipts {
+			if !query.matches(record) {
+				continue
+			}
+			record.Revisions = nil
+			matches = append(matches, Match{ID: id, Record: record, Cursor: Cursor{Key: query.key(record), ID: id}})
+		}
+		sh.mu.RUnlock()
+	}
+	return query.page(matches), nil
+}
@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestRecord(retailer string) Record {
+	return Record{
+		Receipt: models.Receipt{
+			Retailer:     retailer,
+			PurchaseDate: models.MustParseDate("2022-01-01"),
+			PurchaseTime: models.MustParseTimeOfDay("13:01"),
+			Items: []models.Item{
+				{ShortDescription: "Mountain Dew 12PK", Price: models.MustParseMoney("6.49")},
+			},
+			Total: models.MustParseMoney("6.49"),
+		},
+		RuleVersion: 1,
+		Points:      14,
+		CreatedAt:   time.Date(2022, 1, 1, 13, 5, 0, 0, time.UTC),
+	}
+}
+
+func TestMemoryStore_PutGet(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	record := createTestRecord("Target")
+
+	assert.NoError(t, s.Put(ctx, "a", record))
+	found, err := s.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, record, found)
+}
+
+func TestMemoryStore_GetNotFound(t *testing.T) {
+	s := NewMemoryStore()
+	_, err := s.Get(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStore_Delete(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Target")))
+
+	assert.NoError(t, s.Delete(ctx, "a"))
+	_, err := s.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, s.Delete(ctx, "a"), ErrNotFound)
+}
+
+func TestMemoryStore_ListCount(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	assert.NoError(t, s.Put(ctx, "b", createTestRecord("Target")))
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Walgreens")))
+
+	ids, err := s.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+
+	count, err := s.Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestMemoryStore_FindByFingerprint(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	record := createTestRecord("Target")
+	fingerprint := record.Fingerprint()
+	later := record
+	later.CreatedAt = record.CreatedAt.Add(time.Minute)
+	assert.NoError(t, s.Put(ctx, "b", later))
+	assert.NoError(t, s.Put(ctx, "a", record))
+
+	id, err := s.FindByFingerprint(ctx, fingerprint)
+	assert.NoError(t, err)
+	assert.Equal(t, "a", id, "The earliest receipt should be found")
+
+	// Replacing the content moves the receipt out of the old fingerprint
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Walgreens")))
+	id, err = s.FindByFingerprint(ctx, fingerprint)
+	assert.NoError(t, err)
+	assert.Equal(t, "b", id)
+
+	deleted := time.Now()
+	later.DeletedAt = &deleted
+	assert.NoError(t, s.Put(ctx, "b", later))
+	_, err = s.FindByFingerprint(ctx, fingerprint)
+	assert.ErrorIs(t, err, ErrNotFound, "Deleted receipts should not be found")
+
+	assert.NoError(t, s.Delete(ctx, "a"))
+	_, err = s.FindByFingerprint(ctx, createTestRecord("Walgreens").Fingerprint())
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestMemoryStore_CanceledContext(t *testing.T) {
+	s := NewMemoryStore()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, s.Put(ctx, "a", createTestRecord("Target")))
+}
+
+func TestMemoryStore_ConcurrentAccess(t *testing.T) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	record := createTestRecord("Target")
+
+	var wg sync.WaitGroup
+	for w := 0; w < 16; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id := fmt.Sprintf("%d-%d", w, i)
+				assert.NoError(t, s.Put(ctx, id, record))
+				_, err := s.Get(ctx, id)
+				assert.NoError(t, err)
+				_, err = s.List(ctx)
+				assert.NoError(t, err)
+				if i%2 == 0 {
+					assert.NoError(t, s.Delete(ctx, id))
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	count, err := s.Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 16*100, count)
+}
+
+// Mixed workload with roughly one write for every nine reads
+func BenchmarkMemoryStore_MixedReadWrite(b *testing.B) {
+	s := NewMemoryStore()
+	ctx := context.Background()
+	record := createTestRecord("Target")
+	for i := 0; i < 1024; i++ {
+		s.Put(ctx, strconv.Itoa(i), record)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			id := strconv.Itoa(i % 1024)
+			if i%10 == 0 {
+				s.Put(ctx, id, record)
+			} else {
+				s.Get(ctx, id)
+			}
+			i++
+		}
+	})
+}
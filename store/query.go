@@ -0,0 +1,152 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+)
+
+// Orders a query can sort by, named like the API's sort parameter
+const (
+	SortIngestedAt   = "ingestedAt"
+	SortPurchaseDate = "purchaseDate"
+	SortPoints       = "points"
+)
+
+// ReceiptQuery selects one page of the stored receipts. Deleted receipts are
+// never returned and unset filters match every receipt.
+type ReceiptQuery struct {
+	// Matched ignoring the case of ASCII letters only, like SQLite's NOCASE
+	// collation
+	Retailer string
+	// Purchase dates from From to To, both included
+	From, To models.Date
+	// Totals from MinTotal to MaxTotal, both included
+	MinTotal, MaxTotal models.Money
+	// Compared with the points stored at ingest, records stored before rule
+	// sets were versioned need BackfillPoints first
+	MinPoints *int64
+
+	Sort       string
+	Descending bool
+	// Only receipts after this position in the sort order are returned
+	After *Cursor
+	// The most receipts returned, zero returns every match
+	Limit int
+}
+
+// Cursor is the position of a receipt in a sort order. Receipts are ordered
+// by their sort key and then by id, so a cursor stays valid while receipts
+// are added.
+type Cursor struct {
+	Key int64
+	ID  string
+}
+
+// Match is a receipt returned by a query. Records are returned without their
+// revisions.
+type Match struct {
+	ID     string
+	Record Record
+	Cursor Cursor
+}
+
+func (q ReceiptQuery) Validate() error {
+	switch q.Sort {
+	case SortIngestedAt, SortPurchaseDate, SortPoints:
+	default:
+		return fmt.Errorf("unknown sort %q", q.Sort)
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("limit must not be negative")
+	}
+	return nil
+}
+
+func (q ReceiptQuery) matches(record Record) bool {
+	receipt := record.Receipt
+	switch {
+	case record.DeletedAt != nil:
+		return false
+	case q.Retailer != "" && !equalFoldASCII(q.Retailer, receipt.Retailer):
+		return false
+	case !q.From.IsZero() && receipt.PurchaseDate.Time().Before(q.From.Time()):
+		return false
+	case !q.To.IsZero() && receipt.PurchaseDate.Time().After(q.To.Time()):
+		return false
+	case !q.MinTotal.IsZero() && receipt.Total.Cents() < q.MinTotal.Cents():
+		return false
+	case !q.MaxTotal.IsZero() && receipt.Total.Cents() > q.MaxTotal.Cents():
+		return false
+	case q.MinPoints != nil && record.Points < *q.MinPoints:
+		return false
+	}
+	return true
+}
+
+// Reports whether a and b are equal when ASCII letters are folded to lower
+// case, other characters must match exactly
+func equalFoldASCII(a, b string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := 0; i < len(a); i++ {
+		if lowerASCII(a[i]) != lowerASCII(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// The record's key in the query's sort order
+func (q ReceiptQuery) key(record Record) int64 {
+	switch q.Sort {
+	case SortPurchaseDate:
+		return record.PurchaseDate.Time().Unix()
+	case SortPoints:
+		return record.Points
+	default:
+		// Receipts stored before ingest times were recorded come first
+		if record.CreatedAt.IsZero() {
+			return 0
+		}
+		return record.CreatedAt.UnixNano()
+	}
+}
+
+// Reports whether a comes before b in ascending order
+func (a Cursor) less(b Cursor) bool {
+	if a.Key != b.Key {
+		return a.Key < b.Key
+	}
+	return a.ID < b.ID
+}
+
+// Sorts the matches and returns the page the query asks for
+func (q ReceiptQuery) page(matches []Match) []Match {
+	before := func(a Cursor, b Cursor) bool {
+		if q.Descending {
+			return b.less(a)
+		}
+		return a.less(b)
+	}
+	page := matches[:0]
+	for _, match := range matches {
+		if q.After == nil || before(*q.After, match.Cursor) {
+			page = append(page, match)
+		}
+	}
+	sort.Slice(page, func(i, j int) bool { return before(page[i].Cursor, page[j].Cursor) })
+	if q.Limit > 0 && len(page) > q.Limit {
+		page = page[:q.Limit]
+	}
+	return page
+}
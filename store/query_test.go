@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// Stores five receipts a minute apart, on consecutive days, with totals of
+// 1.00 to 5.00 and 10 to 50 points, and a deleted sixth receipt
+func createQueryTestRecords(t *testing.T, s ReceiptStore) {
+	ctx := context.Background()
+	for i, retailer := range []string{"Target", "Walgreens", "target", "M&M Corner Market", "Target", "Target"} {
+		record := createTestRecord(retailer)
+		record.PurchaseDate = models.MustParseDate(fmt.Sprintf("2022-01-%02d", i+1))
+		record.Items = append(record.Items, models.Item{ShortDescription: "Dasani", Price: models.MustParseMoney("1.40")})
+		record.Total = models.MustParseMoney(fmt.Sprintf("%d.00", i+1))
+		record.Points = int64(10 * (i + 1))
+		record.CreatedAt = record.CreatedAt.Add(time.Duration(i) * time.Minute)
+		record.AddRevision(RevisionCreate, record.CreatedAt, "")
+		if i == 5 {
+			deletedAt := record.CreatedAt
+			record.DeletedAt = &deletedAt
+		}
+		assert.NoError(t, s.Put(ctx, fmt.Sprintf("id-%d", i), record))
+	}
+}
+
+func queryIDs(t *testing.T, s ReceiptStore, query ReceiptQuery) []string {
+	if query.Sort == "" {
+		query.Sort = SortIngestedAt
+	}
+	matches, err := s.Query(context.Background(), query)
+	assert.NoError(t, err)
+	ids := []string{}
+	for _, match := range matches {
+		ids = append(ids, match.ID)
+	}
+	return ids
+}
+
+func testQuery(t *testing.T, s ReceiptStore) {
+	createQueryTestRecords(t, s)
+	minPoints := int64(30)
+
+	assert.Equal(t, []string{"id-0", "id-1", "id-2", "id-3", "id-4"}, queryIDs(t, s, ReceiptQuery{}), "Deleted receipts should not be listed")
+	assert.Equal(t, []string{"id-0", "id-2", "id-4"}, queryIDs(t, s, ReceiptQuery{Retailer: "TARGET"}))
+	assert.Equal(t, []string{"id-1", "id-2", "id-3"}, queryIDs(t, s, ReceiptQuery{
+		From: models.MustParseDate("2022-01-02"), To: models.MustParseDate("2022-01-04"),
+	}))
+	assert.Equal(t, []string{"id-1", "id-2"}, queryIDs(t, s, ReceiptQuery{
+		MinTotal: models.MustParseMoney("2.00"), MaxTotal: models.MustParseMoney("3.00"),
+	}))
+	assert.Equal(t, []string{"id-2", "id-3", "id-4"}, queryIDs(t, s, ReceiptQuery{MinPoints: &minPoints}))
+
+	// Pages follow each other without gaps in every sort order
+	for _, sort := range []string{SortIngestedAt, SortPurchaseDate, SortPoints} {
+		query := ReceiptQuery{Sort: sort, Descending: true, Limit: 2}
+		ids := []string{}
+		for {
+			matches, err := s.Query(context.Background(), query)
+			assert.NoError(t, err)
+			for _, match := range matches {
+				ids = append(ids, match.ID)
+			}
+			if len(matches) < query.Limit {
+				break
+			}
+			query.After = &matches[len(matches)-1].Cursor
+		}
+		assert.Equal(t, []string{"id-4", "id-3", "id-2", "id-1", "id-0"}, ids, "Unexpected order sorting by %s", sort)
+	}
+
+	matches, err := s.Query(context.Background(), ReceiptQuery{Sort: SortPoints, Limit: 1})
+	assert.NoError(t, err)
+	if assert.Len(t, matches, 1) {
+		assert.Len(t, matches[0].Record.Items, 2, "Matches should hold their items")
+		assert.Empty(t, matches[0].Record.Revisions)
+	}
+	_, err = s.Query(context.Background(), ReceiptQuery{Sort: "retailer"})
+	assert.Error(t, err)
+
+	// Both backends fold the case of ASCII letters only
+	assert.NoError(t, s.Put(context.Background(), "id-6", createTestRecord("Café")))
+	assert.Equal(t, []string{"id-6"}, queryIDs(t, s, ReceiptQuery{Retailer: "CAFé"}))
+	assert.Empty(t, queryIDs(t, s, ReceiptQuery{Retailer: "CAFÉ"}))
+}
+
+func TestMemoryStore_Query(t *testing.T) {
+	testQuery(t, NewMemoryStore())
+}
+
+func TestSQLStore_Query(t *testing.T) {
+	s := openTestSQLStore(t, filepath.Join(t.TempDir(), "receipts.db"))
+	defer s.Close()
+	testQuery(t, s)
+}
+
+// Ingest times written before they were padded still sort in time order
+func TestSQLStore_QueryMigratesIngestTimes(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "receipts.db")
+	db, err := sql.Open("sqlite", dsn)
+	assert.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY)`)
+	assert.NoError(t, err)
+	for version, migration := range migrations[:6] {
+		_, err := db.Exec(migration)
+		assert.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, version+1)
+		assert.NoError(t, err)
+	}
+	for id, createdAt := range map[string]string{"a": "2022-01-01T13:05:00.5Z", "b": "2022-01-01T13:05:00Z", "c": ""} {
+		_, err := db.Exec(`INSERT INTO receipts (id, retailer, purchase_date, purchase_time, total, created_at)
+			VALUES (?, 'Target', '2022-01-01', '13:01', '6.49', ?)`, id, createdAt)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, db.Close())
+
+	s := openTestSQLStore(t, dsn)
+	defer s.Close()
+	assert.Equal(t, []string{"c", "b", "a"}, queryIDs(t, s, ReceiptQuery{}))
+	record, err := s.Get(context.Background(), "a")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2022, 1, 1, 13, 5, 0, 5e8, time.UTC), record.CreatedAt)
+}
@@ -0,0 +1,534 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"go.uber.org/zap"
+)
+
+// Schema changes are only ever appended, a migration's position in the list is
+// its version number
+var migrations = []string{
+	`CREATE TABLE receipts (
+		id            TEXT PRIMARY KEY,
+		retailer      TEXT NOT NULL,
+		purchase_date TEXT NOT NULL,
+		purchase_time TEXT NOT NULL,
+		total         TEXT NOT NULL
+	);
+	CREATE INDEX idx_receipts_retailer ON receipts (retailer);
+	CREATE INDEX idx_receipts_purchase_date ON receipts (purchase_date);
+	CREATE TABLE items (
+		receipt_id        TEXT NOT NULL REFERENCES receipts (id) ON DELETE CASCADE,
+		position          INTEGER NOT NULL,
+		short_description TEXT NOT NULL,
+		price             TEXT NOT NULL,
+		PRIMARY KEY (receipt_id, position)
+	);`,
+	`ALTER TABLE receipts ADD COLUMN rule_version INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE receipts ADD COLUMN points INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE receipts ADD COLUMN created_at TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE receipts ADD COLUMN inconsistent INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE receipts ADD COLUMN deleted_at TEXT NOT NULL DEFAULT '';
+	CREATE TABLE revisions (
+		receipt_id   TEXT NOT NULL REFERENCES receipts (id) ON DELETE CASCADE,
+		revision     INTEGER NOT NULL,
+		action       TEXT NOT NULL,
+		receipt      TEXT NOT NULL,
+		points       INTEGER NOT NULL,
+		rule_version INTEGER NOT NULL,
+		changed_at   TEXT NOT NULL,
+		PRIMARY KEY (receipt_id, revision)
+	);`,
+	`ALTER TABLE receipts ADD COLUMN fingerprint TEXT NOT NULL DEFAULT '';
+	ALTER TABLE receipts ADD COLUMN duplicate_of TEXT NOT NULL DEFAULT '';
+	CREATE INDEX idx_receipts_fingerprint ON receipts (fingerprint);`,
+	`ALTER TABLE receipts ADD COLUMN submitted_by TEXT NOT NULL DEFAULT '';
+	ALTER TABLE revisions ADD COLUMN changed_by TEXT NOT NULL DEFAULT '';`,
+	// Pads ingest times to nine fraction digits so they sort as text
+	`UPDATE receipts SET created_at = CASE
+		WHEN created_at = '' THEN ''
+		WHEN instr(created_at, '.') = 0 THEN substr(created_at, 1, 19) || '.000000000Z'
+		ELSE substr(created_at, 1, 20) || substr(substr(created_at, 21, length(created_at) - 21) || '000000000', 1, 9) || 'Z'
+	END;
+	CREATE INDEX idx_receipts_created_at ON receipts (created_at);
+	CREATE INDEX idx_receipts_points ON receipts (points);
+	CREATE INDEX idx_receipts_retailer_nocase ON receipts (retailer COLLATE NOCASE);`,
+}
+
+// SQLStore keeps receipts in an embedded SQL database. Receipts and their
+// items are normalized into separate tables. The database driver is picked by
+// name, the pure Go SQLite driver is linked in and registered as "sqlite".
+type SQLStore struct {
+	db *sql.DB
+}
+
+// Opens the database and applies any migrations it has not seen yet
+func OpenSQLStore(driver string, dsn string) (*SQLStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s database: %w", driver, err)
+	}
+	// SQLite allows a single writer, sharing one connection avoids busy errors
+	db.SetMaxOpenConns(1)
+
+	s := &SQLStore{db: db}
+	if err := s.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLStore) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("error creating migrations table: %w", err)
+	}
+
+	var current int
+	if err := s.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("error reading schema version: %w", err)
+	}
+
+	for version := current + 1; version <= len(migrations); version++ {
+		err := s.withTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, migrations[version-1]); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("error applying migration %d: %w", version, err)
+		}
+		zap.L().Info(fmt.Sprintf("Applied database migration %d", version))
+	}
+	return nil
+}
+
+func (s *SQLStore) withTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLStore) Put(ctx context.Context, id string, record Record) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		return put(ctx, tx, id, record)
+	})
+}
+
+// Stores the records in one transaction
+func (s *SQLStore) PutAll(ctx context.Context, records map[string]Record) error {
+	ids := make([]string, 0, len(records))
+	for id := range records {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		for _, id := range ids {
+			if err := put(ctx, tx, id, records[id]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Upserts the record and replaces its items and revisions
+func put(ctx context.Context, tx *sql.Tx, id string, record Record) error {
+	receipt := record.Receipt
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO receipts (id, retailer, purchase_date, purchase_time, total, rule_version, points, created_at, inconsistent, deleted_at,
+			fingerprint, duplicate_of, submitted_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET
+			retailer = excluded.retailer,
+			purchase_date = excluded.purchase_date,
+			purchase_time = excluded.purchase_time,
+			total = excluded.total,
+			rule_version = excluded.rule_version,
+			points = excluded.points,
+			created_at = excluded.created_at,
+			inconsistent = excluded.inconsistent,
+			deleted_at = excluded.deleted_at,
+			fingerprint = excluded.fingerprint,
+			duplicate_of = excluded.duplicate_of,
+			submitted_by = excluded.submitted_by`,
+		id, receipt.Retailer, receipt.PurchaseDate, receipt.PurchaseTime, receipt.Total,
+		record.RuleVersion, record.Points, formatTime(record.CreatedAt), record.Inconsistent,
+		formatOptionalTime(record.DeletedAt), record.indexedFingerprint(), record.DuplicateOf, record.SubmittedBy)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM items WHERE receipt_id = ?`, id); err != nil {
+		return err
+	}
+	for position, item := range receipt.Items {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO items (receipt_id, position, short_description, price)
+			VALUES (?, ?, ?, ?)`,
+			id, position, item.ShortDescription, item.Price)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM revisions WHERE receipt_id = ?`, id); err != nil {
+		return err
+	}
+	for _, revision := range record.Revisions {
+		// Receipts are kept as JSON, revisions are only ever read back whole
+		receipt := ""
+		if revision.Receipt != nil {
+			data, err := json.Marshal(revision.Receipt)
+			if err != nil {
+				return err
+			}
+			receipt = string(data)
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO revisions (receipt_id, revision, action, receipt, points, rule_version, changed_at, changed_by)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, revision.Revision, revision.Action, receipt, revision.Points, revision.RuleVersion,
+			formatTime(revision.ChangedAt), revision.ChangedBy)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Columns read by scanRecord, in order
+const recordColumns = `retailer, purchase_date, purchase_time, total, rule_version, points, created_at, inconsistent, deleted_at,
+	duplicate_of, submitted_by`
+
+// Reads the recordColumns of a row, after any leading columns read into first
+func scanRecord(scan func(dest ...interface{}) error, first ...interface{}) (Record, error) {
+	var record Record
+	var createdAt, deletedAt string
+	receipt := &record.Receipt
+	dest := append(first, &receipt.Retailer, &receipt.PurchaseDate, &receipt.PurchaseTime, &receipt.Total,
+		&record.RuleVersion, &record.Points, &createdAt, &record.Inconsistent, &deletedAt,
+		&record.DuplicateOf, &record.SubmittedBy)
+	if err := scan(dest...); err != nil {
+		return Record{}, err
+	}
+	var err error
+	if record.CreatedAt, err = parseTime(createdAt); err != nil {
+		return Record{}, err
+	}
+	if record.DeletedAt, err = parseOptionalTime(deletedAt); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Record, error) {
+	record, err := scanRecord(s.db.QueryRowContext(ctx, `SELECT `+recordColumns+` FROM receipts WHERE id = ?`, id).Scan)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, ErrNotFound
+	}
+	if err != nil {
+		return Record{}, err
+	}
+	// Only one connection is open, so each query is read to the end before the next
+	if record.Items, err = s.items(ctx, id); err != nil {
+		return Record{}, err
+	}
+	if record.Revisions, err = s.revisions(ctx, id); err != nil {
+		return Record{}, err
+	}
+	return record, nil
+}
+
+func (s *SQLStore) items(ctx context.Context, id string) ([]models.Item, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT short_description, price
+		FROM items WHERE receipt_id = ? ORDER BY position`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []models.Item{}
+	for rows.Next() {
+		var item models.Item
+		if err := rows.Scan(&item.ShortDescription, &item.Price); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (s *SQLStore) revisions(ctx context.Context, id string) ([]Revision, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT revision, action, receipt, points, rule_version, changed_at, changed_by
+		FROM revisions WHERE receipt_id = ? ORDER BY revision`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var revisions []Revision
+	for rows.Next() {
+		var revision Revision
+		var receipt, changedAt string
+		if err := rows.Scan(&revision.Revision, &revision.Action, &receipt, &revision.Points,
+			&revision.RuleVersion, &changedAt, &revision.ChangedBy); err != nil {
+			return nil, err
+		}
+		if receipt != "" {
+			revision.Receipt = &models.Receipt{}
+			if err := json.Unmarshal([]byte(receipt), revision.Receipt); err != nil {
+				return nil, err
+			}
+		}
+		if revision.ChangedAt, err = parseTime(changedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// Times are stored as RFC 3339 text in UTC with nine fraction digits, so they
+// sort in time order. The empty string stands for the zero time.
+const timeLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(timeLayout)
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return formatTime(*t)
+}
+
+func parseOptionalTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := parseTime(value)
+	return &t, err
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM revisions WHERE receipt_id = ?`, id); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM items WHERE receipt_id = ?`, id); err != nil {
+			return err
+		}
+		result, err := tx.ExecContext(ctx, `DELETE FROM receipts WHERE id = ?`, id)
+		if err != nil {
+			return err
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+func (s *SQLStore) List(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id FROM receipts ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *SQLStore) Count(ctx context.Context) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM receipts`).Scan(&count)
+	return count, err
+}
+
+// Receipts stored before fingerprints were recorded are never found
+func (s *SQLStore) FindByFingerprint(ctx context.Context, fingerprint string) (string, error) {
+	var id string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM receipts WHERE fingerprint = ?
+		ORDER BY created_at, id LIMIT 1`, fingerprint).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return id, err
+}
+
+// Columns holding the sort keys of a query
+var sortColumns = map[string]string{
+	SortIngestedAt:   "created_at",
+	SortPurchaseDate: "purchase_date",
+	SortPoints:       "points",
+}
+
+// Filters, sorts and pages in the database, using the indexes on the filtered
+// and sorted columns. Items are read for the whole page in one query.
+func (s *SQLStore) Query(ctx context.Context, query ReceiptQuery) ([]Match, error) {
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	conditions := []string{`deleted_at = ''`}
+	args := []interface{}{}
+	where := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+	if query.Retailer != "" {
+		where(`retailer = ? COLLATE NOCASE`, query.Retailer)
+	}
+	if !query.From.IsZero() {
+		where(`purchase_date >= ?`, query.From.String())
+	}
+	if !query.To.IsZero() {
+		where(`purchase_date <= ?`, query.To.String())
+	}
+	// Totals are stored with two fraction digits, so removing the point gives cents
+	if !query.MinTotal.IsZero() {
+		where(`CAST(REPLACE(total, '.', '') AS INTEGER) >= ?`, query.MinTotal.Cents())
+	}
+	if !query.MaxTotal.IsZero() {
+		where(`CAST(REPLACE(total, '.', '') AS INTEGER) <= ?`, query.MaxTotal.Cents())
+	}
+	if query.MinPoints != nil {
+		where(`points >= ?`, *query.MinPoints)
+	}
+	column, direction, after := sortColumns[query.Sort], "ASC", ">"
+	if query.Descending {
+		direction, after = "DESC", "<"
+	}
+	if query.After != nil {
+		key := storedKey(query.Sort, query.After.Key)
+		where(fmt.Sprintf(`(%s %s ? OR %s = ? AND id %s ?)`, column, after, column, after), key, key, query.After.ID)
+	}
+	statement := fmt.Sprintf(`SELECT id, %s FROM receipts WHERE %s ORDER BY %s %s, id %s`,
+		recordColumns, strings.Join(conditions, " AND "), column, direction, direction)
+	if query.Limit > 0 {
+		statement += ` LIMIT ?`
+		args = append(args, query.Limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	matches := []Match{}
+	for rows.Next() {
+		var id string
+		record, err := scanRecord(rows.Scan, &id)
+		if err != nil {
+			return nil, err
+		}
+		record.Items = []models.Item{}
+		matches = append(matches, Match{ID: id, Record: record, Cursor: Cursor{Key: query.key(record), ID: id}})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	if err := s.pageItems(ctx, matches); err != nil {
+		return nil, err
+	}
+	return matches, nil
+}
+
+// The stored value of a cursor key for sort columns that are not numbers
+func storedKey(sort string, key int64) interface{} {
+	switch sort {
+	case SortPurchaseDate:
+		return time.Unix(key, 0).UTC().Format("2006-01-02")
+	case SortIngestedAt:
+		// Receipts without an ingest time have key 0
+		if key == 0 {
+			return ""
+		}
+		return formatTime(time.Unix(0, key))
+	default:
+		return key
+	}
+}
+
+// Most ids bound in one query, well below SQLite's limit on variables
+const maxQueryIDs = 500
+
+// Reads the items of every match, a batch of receipts per query
+func (s *SQLStore) pageItems(ctx context.Context, matches []Match) error {
+	positions := make(map[string]int, len(matches))
+	for i, match := range matches {
+		positions[match.ID] = i
+	}
+	for start := 0; start < len(matches); start += maxQueryIDs {
+		batch := matches[start:min(start+maxQueryIDs, len(matches))]
+		ids := make([]interface{}, len(batch))
+		for i, match := range batch {
+			ids[i] = match.ID
+		}
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT receipt_id, short_description, price
+			FROM items WHERE receipt_id IN (?`+strings.Repeat(", ?", len(ids)-1)+`) ORDER BY receipt_id, position`, ids...)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id string
+			var item models.Item
+			if err := rows.Scan(&id, &item.ShortDescription, &item.Price); err != nil {
+				rows.Close()
+				return err
+			}
+			receipt := &matches[positions[id]].Record.Receipt
+			receipt.Items = append(receipt.Items, item)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
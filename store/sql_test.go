@@ -0,0 +1,75 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func openTestSQLStore(t *testing.T, dsn string) *SQLStore {
+	s, err := OpenSQLStore("sqlite", dsn)
+	if err != nil {
+		t.Fatalf("Error opening sql store: %v", err)
+	}
+	return s
+}
+
+func TestSQLStore_PutGet(t *testing.T) {
+	s := openTestSQLStore(t, filepath.Join(t.TempDir(), "receipts.db"))
+	defer s.Close()
+	ctx := context.Background()
+	record := createTestRecord("Target")
+	record.Items = append(record.Items, models.Item{ShortDescription: "Emils Cheese Pizza", Price: models.MustParseMoney("12.25")})
+
+	assert.NoError(t, s.Put(ctx, "a", record))
+	found, err := s.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, record, found)
+
+	// Replacing a receipt replaces its items
+	record.Items = record.Items[:1]
+	assert.NoError(t, s.Put(ctx, "a", record))
+	found, err = s.Get(ctx, "a")
+	assert.NoError(t, err)
+	assert.Equal(t, record, found)
+}
+
+func TestSQLStore_DeleteListCount(t *testing.T) {
+	s := openTestSQLStore(t, filepath.Join(t.TempDir(), "receipts.db"))
+	defer s.Close()
+	ctx := context.Background()
+	assert.NoError(t, s.Put(ctx, "b", createTestRecord("Target")))
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Walgreens")))
+
+	ids, err := s.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids)
+
+	assert.NoError(t, s.Delete(ctx, "a"))
+	assert.ErrorIs(t, s.Delete(ctx, "a"), ErrNotFound)
+	_, err = s.Get(ctx, "a")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	count, err := s.Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestSQLStore_MigrationsRunOnce(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "receipts.db")
+	s := openTestSQLStore(t, dsn)
+	ctx := context.Background()
+	assert.NoError(t, s.Put(ctx, "a", createTestRecord("Target")))
+	assert.NoError(t, s.Close())
+
+	reopened := openTestSQLStore(t, dsn)
+	defer reopened.Close()
+	var version int
+	assert.NoError(t, reopened.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version))
+	assert.Equal(t, len(migrations), version)
+	_, err := reopened.Get(ctx, "a")
+	assert.NoError(t, err)
+}
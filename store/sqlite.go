@@ -0,0 +1,4 @@
+package store
+
+// Registers the cgo-free SQLite driver under the name "sqlite"
+import _ "modernc.org/sqlite"
@@ -1,6 +1,152 @@
 package store
 
-import "github.com/jiyo4476/receipt-processor-challenge/models"
+import (
+	"context"
+	"errors"
+	"time"
 
-// Map for in-memory data storage
-var Receipts = make(map[string]models.Receipt)
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+)
+
+// Returned when no receipt is stored under the requested id
+var ErrNotFound = errors.New("receipt not found")
+
+// Record is a receipt as it was accepted, together with the points it was
+// awarded at ingest and the version of the rules that scored it
+type Record struct {
+	models.Receipt
+	// Zero for receipts stored before rule sets were versioned
+	RuleVersion int       `json:"ruleVersion,omitempty"`
+	Points      int64     `json:"points"`
+	CreatedAt   time.Time `json:"createdAt"`
+	// Set when the total did not match the items under the consistency policy
+	Inconsistent bool `json:"inconsistent,omitempty"`
+	// Id of the stored receipt this one duplicated when it was accepted or
+	// last changed
+	DuplicateOf string `json:"duplicateOf,omitempty"`
+	// The client identity that submitted the receipt, "key:" and the API key
+	// name or "token:" and the issuer and subject, empty when authentication
+	// is off
+	SubmittedBy string `json:"submittedBy,omitempty"`
+	// Set once the receipt is deleted, its history is kept
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	// Every change made to the receipt, oldest first
+	Revisions []Revision `json:"revisions,omitempty"`
+}
+
+// What a revision did to the receipt
+const (
+	RevisionCreate  = "create"
+	RevisionReplace = "replace"
+	RevisionPatch   = "patch"
+	RevisionDelete  = "delete"
+)
+
+// Revision is the state of a receipt after one change
+type Revision struct {
+	Revision int    `json:"revision"`
+	Action   string `json:"action"`
+	// Missing for deletions
+	Receipt     *models.Receipt `json:"receipt,omitempty"`
+	Points      int64           `json:"points"`
+	RuleVersion int             `json:"ruleVersion,omitempty"`
+	ChangedAt   time.Time       `json:"changedAt"`
+	// The client identity that made the change
+	ChangedBy string `json:"changedBy,omitempty"`
+}
+
+// Returns the record's revisions. Records stored before revisions were kept
+// report their current state as the only revision.
+func (r Record) History() []Revision {
+	if len(r.Revisions) > 0 {
+		return r.Revisions
+	}
+	receipt := r.Receipt
+	return []Revision{{
+		Revision:    1,
+		Action:      RevisionCreate,
+		Receipt:     &receipt,
+		Points:      r.Points,
+		RuleVersion: r.RuleVersion,
+		ChangedAt:   r.CreatedAt,
+		ChangedBy:   r.SubmittedBy,
+	}}
+}
+
+// Records the record's current state as a new revision made by the given
+// client
+func (r *Record) AddRevision(action string, at time.Time, by string) {
+	revision := Revision{
+		Revision:    len(r.Revisions) + 1,
+		Action:      action,
+		Points:      r.Points,
+		RuleVersion: r.RuleVersion,
+		ChangedAt:   at,
+		ChangedBy:   by,
+	}
+	if action != RevisionDelete {
+		receipt := r.Receipt
+		revision.Receipt = &receipt
+	}
+	r.Revisions = append(r.Revisions, revision)
+}
+
+// ReceiptStore is implemented by every receipt storage backend
+type ReceiptStore interface {
+	// Saves the record under id, replacing any record already stored there
+	Put(ctx context.Context, id string, record Record) error
+	// Saves each record under its id like Put, either every record is stored
+	// or none are
+	PutAll(ctx context.Context, records map[string]Record) error
+	// Returns the record stored under id or ErrNotFound
+	Get(ctx context.Context, id string) (Record, error)
+	// Removes the record stored under id or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+	// Returns the ids of every stored record in ascending order
+	List(ctx context.Context) ([]string, error)
+	// Returns the number of stored records
+	Count(ctx context.Context) (int, error)
+	// Returns the id of the earliest created record that is not deleted and
+	// whose receipt has the fingerprint, or ErrNotFound
+	FindByFingerprint(ctx context.Context, fingerprint string) (string, error)
+	// Returns the records matching the query in its sort order
+	Query(ctx context.Context, query ReceiptQuery) ([]Match, error)
+}
+
+// Scores the records stored before rule sets were versioned with rules and
+// stores their points and rule version, so queries filter and sort on the
+// points responses report. Returns the number of records updated.
+func BackfillPoints(ctx context.Context, s ReceiptStore, rules models.RuleSet) (int, error) {
+	ids, err := s.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	updated := 0
+	for _, id := range ids {
+		record, err := s.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return updated, err
+		}
+		if record.RuleVersion != 0 {
+			continue
+		}
+		record.Points, _ = rules.Points(record.Receipt)
+		record.RuleVersion = rules.Version
+		if err := s.Put(ctx, id, record); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// Fingerprint a record is indexed under, deleted records are not indexed
+func (r Record) indexedFingerprint() string {
+	if r.DeletedAt != nil {
+		return ""
+	}
+	return r.Receipt.Fingerprint()
+}
@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jiyo4476/receipt-processor-challenge/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordHistory_Legacy(t *testing.T) {
+	record := createTestRecord("Target")
+	record.RuleVersion = 1
+	record.SubmittedBy = "pos-terminals"
+
+	history := record.History()
+	assert.Len(t, history, 1, "Records without revisions should report their current state")
+	assert.Equal(t, RevisionCreate, history[0].Action)
+	assert.Equal(t, record.Receipt, *history[0].Receipt)
+	assert.Equal(t, record.CreatedAt, history[0].ChangedAt)
+	assert.Equal(t, "pos-terminals", history[0].ChangedBy)
+}
+
+func TestRecordAddRevision(t *testing.T) {
+	record := createTestRecord("Target")
+	record.AddRevision(RevisionCreate, record.CreatedAt, "pos-terminals")
+
+	record.Retailer = "Walgreens"
+	record.AddRevision(RevisionPatch, time.Now(), "support")
+	record.AddRevision(RevisionDelete, time.Now(), "")
+
+	history := record.History()
+	assert.Len(t, history, 3)
+	assert.Equal(t, "Target", history[0].Receipt.Retailer, "Revisions should not share the receipt")
+	assert.Equal(t, "Walgreens", history[1].Receipt.Retailer)
+	assert.Equal(t, "support", history[1].ChangedBy)
+	assert.Equal(t, 3, history[2].Revision)
+	assert.Nil(t, history[2].Receipt)
+}
+
+func TestBackfillPoints(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemoryStore()
+	legacy := createTestRecord("Target")
+	legacy.RuleVersion = 0
+	legacy.Points = 0
+	assert.NoError(t, s.Put(ctx, "legacy", legacy))
+	assert.NoError(t, s.Put(ctx, "scored", createTestRecord("Walgreens")))
+
+	rules := models.DefaultRuleSet()
+	rules.Version = 2
+	updated, err := BackfillPoints(ctx, s, rules)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updated)
+
+	record, err := s.Get(ctx, "legacy")
+	assert.NoError(t, err)
+	points, _ := rules.Points(legacy.Receipt)
+	assert.Equal(t, points, record.Points)
+	assert.Equal(t, 2, record.RuleVersion)
+	record, err = s.Get(ctx, "scored")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, record.RuleVersion, "Records scored at ingest keep their points")
+
+	updated, err = BackfillPoints(ctx, s, rules)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, updated)
+}
+
+func testPutAll(t *testing.T, s ReceiptStore) {
+	ctx := context.Background()
+	target := createTestRecord("Target")
+	assert.NoError(t, s.PutAll(ctx, map[string]Record{"a": target, "b": createTestRecord("Walgreens")}))
+	found, err := s.Get(ctx, "b")
+	assert.NoError(t, err)
+	assert.Equal(t, "Walgreens", found.Retailer)
+	id, err := s.FindByFingerprint(ctx, target.Fingerprint())
+	assert.NoError(t, err)
+	assert.Equal(t, "a", id)
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.Error(t, s.PutAll(canceled, map[string]Record{"c": createTestRecord("Costco")}))
+	count, err := s.Count(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count, "Nothing should be stored when PutAll fails")
+}
+
+func TestMemoryStore_PutAll(t *testing.T) {
+	testPutAll(t, NewMemoryStore())
+}
+
+func TestFileStore_PutAll(t *testing.T) {
+	dir := t.TempDir()
+	s := openTestFileStore(t, dir)
+	testPutAll(t, s)
+	crash(s)
+
+	reopened := openTestFileStore(t, dir)
+	defer reopened.Close()
+	ids, err := reopened.List(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, ids, "Replay should restore every record of the batch")
+}
+
+func TestSQLStore_PutAll(t *testing.T) {
+	s := openTestSQLStore(t, filepath.Join(t.TempDir(), "receipts.db"))
+	defer s.Close()
+	testPutAll(t, s)
+}